@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/Taik/zing-mp3/zing"
+	"github.com/mattn/go-isatty"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+func downloadCommand() (*flag.FlagSet, func() int) {
+	f := newAlbumFlags("download")
+	var (
+		downloadDir = f.flags.String("dir", ".", "Directory to download into")
+		quiet       = f.flags.Bool("quiet", false, "Only print errors")
+		jsonOutput  = f.flags.Bool("json", false, "Print one JSON event per line on stdout")
+		interactive = f.flags.Bool("interactive", false, "Choose the tracks to download from a list before downloading")
+		concurrency = f.flags.Int("concurrency", 0, "Tracks downloaded at once (0 for all of them)")
+		skipTags    = f.flags.Bool("skip-tags", false, "Keep downloaded files as served, without writing ID3 tags")
+		enrich      = f.flags.Bool("enrich", true, "Look up album, genre, year, composer and duration of each track before tagging")
+		skipArtwork = f.flags.Bool("skip-artwork", false, "Neither embed cover art nor save it as "+zing.ArtworkName)
+		artworkSize = f.flags.Int("artwork-size", zing.DefaultArtworkSize, "Largest width or height of cover art, scaling larger covers down (0 keeps them as served)")
+		id3v1       = f.flags.String("id3v1", "ascii", id3v1Usage)
+	)
+	return f.flags, func() int {
+		// Logs go to stderr so they never interleave with the progress display or JSON events on stdout.
+		logLevel := f.level()
+		display := isatty.IsTerminal(os.Stdout.Fd()) && !*jsonOutput && !*quiet && !*f.verbose
+		if display {
+			// Failures are shown by the display itself; logging them would break the redraw.
+			logLevel = log.LvlCrit
+		}
+		setupLogging(logLevel)
+		if !setID3v1(*id3v1) {
+			return 2
+		}
+		zing.DefaultClient.Concurrency = *concurrency
+		zing.DefaultClient.SkipTags = *skipTags
+		zing.DefaultClient.SkipArtwork = *skipArtwork
+		zing.DefaultClient.ArtworkSize = *artworkSize
+		if *enrich && !*skipTags {
+			zing.DefaultClient.Enricher = zing.NewEnricher(zing.DefaultClient)
+		}
+
+		album, ok := f.load()
+		if !ok {
+			return 1
+		}
+
+		// Pick tracks before anything is drawn, since the picker takes over the terminal.
+		if *interactive {
+			if !isatty.IsTerminal(os.Stdin.Fd()) {
+				log.Crit("-interactive needs a terminal on stdin")
+				return 1
+			}
+			var err error
+			album, err = pickItems(album, *downloadDir)
+			if err != nil {
+				log.Crit("No tracks downloaded", "reason", err)
+				return 1
+			}
+		}
+
+		var observer zing.Observer
+		closeDisplay := func() {}
+		switch {
+		case *jsonOutput:
+			observer = newJSONProgress(os.Stdout)
+		case *quiet:
+			observer = zing.NopObserver{}
+		case display:
+			tty := newTTYProgress(os.Stdout)
+			closeDisplay = tty.Close
+			observer = tty
+		default:
+			observer = &lineProgress{out: os.Stdout}
+		}
+		zing.DefaultClient.Observer = observer
+
+		observer.AlbumParsed(album)
+		results := zing.DefaultClient.DownloadAlbum(context.Background(), album, *downloadDir)
+		closeDisplay()
+
+		failed := 0
+		for _, result := range results {
+			if result.Err != nil {
+				failed++
+				log.Error("Item failed",
+					"title", result.Item.Title,
+					"attempts", len(result.Attempts),
+					"error", result.Err,
+				)
+			}
+		}
+		if failed > 0 {
+			log.Error("Some items could not be downloaded", "failed", failed, "total", len(results))
+			return 1
+		}
+		return 0
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+func infoCommand() (*flag.FlagSet, func() int) {
+	f := newAlbumFlags("info")
+	jsonOutput := f.flags.Bool("json", false, "Print the album as JSON")
+	return f.flags, func() int {
+		setupLogging(f.level())
+
+		album, ok := f.load()
+		if !ok {
+			return 1
+		}
+
+		if *jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(album)
+			return 0
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "#\tARTIST\tTITLE\tID\tLYRICS\tFILENAME")
+		for i, item := range album.Items {
+			lyrics := "no"
+			if item.LyricURL != "" {
+				lyrics = "yes"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", i+1, item.Artist, item.Title, item.ID(), lyrics, item.Name())
+		}
+		w.Flush()
+		return 0
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/Taik/zing-mp3/zing"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+func lyricsCommand() (*flag.FlagSet, func() int) {
+	f := newAlbumFlags("lyrics")
+	downloadDir := f.flags.String("dir", ".", "Directory to save the lyrics into")
+	return f.flags, func() int {
+		setupLogging(f.level())
+
+		album, ok := f.load()
+		if !ok {
+			return 1
+		}
+
+		failed := 0
+		for _, item := range album.Items {
+			path, err := zing.DefaultClient.DownloadLyrics(context.Background(), item, *downloadDir)
+			switch {
+			case err == zing.ErrNoLyrics:
+				fmt.Printf("No lyrics for %s - %s\n", item.Artist, item.Title)
+			case err != nil:
+				failed++
+				log.Error("Unable to download lyrics", "title", item.Title, "error", err)
+			default:
+				fmt.Printf("Saved %s\n", path)
+			}
+		}
+		if failed > 0 {
+			return 1
+		}
+		return 0
+	}
+}
@@ -1,20 +1,290 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/Taik/zing-mp3/config"
+	_ "github.com/Taik/zing-mp3/provider/nhaccuatui"
+	"github.com/Taik/zing-mp3/server"
+	"github.com/Taik/zing-mp3/tags"
 	"github.com/Taik/zing-mp3/zing"
+	"github.com/Taik/zing-mp3/zing/api"
 	log "gopkg.in/inconshreveable/log15.v2"
 )
 
+// command is a zing-dl subcommand. setup defines its flags and returns the function
+// running it once they are parsed, which returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	setup   func() (*flag.FlagSet, func() int)
+}
+
+var commands []command
+
+func init() {
+	// Assigned here since the config command walks the list itself.
+	commands = []command{
+		{"search", "Search for songs, albums, artists or videos", searchCommand},
+		{"info", "Print album metadata without downloading", infoCommand},
+		{"download", "Download and tag the tracks of an album", downloadCommand},
+		{"tag", "Re-tag previously downloaded tracks", tagCommand},
+		{"tags", "Show the ID3 tags of files: tags show [-json] file...", tagsCommand},
+		{"lyrics", "Download the lyrics of an album's tracks", lyricsCommand},
+		{"serve", "Run the web server", serveCommand},
+		{"config", "Print the effective configuration: config print [command...]", configCommand},
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: zing-dl <command> [flags] [url]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun 'zing-dl <command> -h' for the flags of a command.\n")
+}
+
+func lookupCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// run parses args with the command's flags, fills in the rest from the
+// environment and config file, and runs it.
+func (c command) run(args []string) int {
+	flags, run := c.setup()
+	flags.Parse(args)
+	if _, err := config.Apply(flags); err != nil {
+		log.Crit("Unable to load config", "error", err)
+		return 2
+	}
+	return run()
+}
+
 func main() {
-	var (
-		zingURL     = flag.String("url", "", "Zing MP3 URL to be parsed")
-		downloadDir = flag.String("dir", ".", "Directory to download into")
-	)
-	flag.Parse()
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	// Flags without a command are the original invocation, e.g. zing-dl -url=...
+	if strings.HasPrefix(args[0], "-") && args[0] != "-h" && args[0] != "-help" && args[0] != "--help" {
+		c, _ := lookupCommand("download")
+		os.Exit(c.run(args))
+	}
+
+	if c, ok := lookupCommand(args[0]); ok {
+		os.Exit(c.run(args[1:]))
+	}
+
+	if args[0] != "help" && !strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(os.Stderr, "zing-dl: unknown command %q\n\n", args[0])
+	}
+	usage()
+	os.Exit(2)
+}
+
+// albumFlags are the flags shared by the commands working on an album.
+type albumFlags struct {
+	flags       *flag.FlagSet
+	url         *string
+	cacheDir    *string
+	cacheTTL    *time.Duration
+	items       *string
+	match       *string
+	exclude     *string
+	maxAttempts *int
+	logLevel    *string
+	verbose     *bool
+	apiKey      *string
+	apiSecret   *string
+	apiVersion  *string
+	cookies     *string
+	name        *string
+}
+
+func newAlbumFlags(name string) *albumFlags {
+	flags := config.NewFlagSet(name, flag.ExitOnError)
+	return &albumFlags{
+		flags:       flags,
+		url:         flags.String("url", "", "Zing MP3 URL to be parsed (or the first argument)"),
+		cacheDir:    flags.String("cache-dir", "", "Directory to cache parsed albums in"),
+		cacheTTL:    flags.Duration("cache-ttl", zing.DefaultCacheTTL, "How long parsed albums are cached"),
+		items:       flags.String("items", "", "Item numbers to use, e.g. 1-5,9 (all if empty)"),
+		match:       flags.String("match", "", "Only use items whose \"Artist - Title\" matches this regexp"),
+		exclude:     flags.String("exclude", "", "Item numbers to skip, e.g. 3,7-8"),
+		maxAttempts: flags.Int("max-attempts", zing.DefaultRetryPolicy.MaxAttempts, "Attempts per request before giving up"),
+		logLevel:    flags.String("log-level", "error", "Minimum level logged to stderr: debug, info, warn, error or crit"),
+		verbose:     flags.Bool("v", false, "Print debug logs"),
+		apiKey:      flags.String("api-key", "", "Zing JSON API key, used when a page cannot be scraped"),
+		apiSecret:   flags.String("api-secret", "", "Zing JSON API signing secret"),
+		apiVersion:  flags.String("api-version", "", "Zing web player version sent with JSON API requests"),
+		cookies:     flags.String("cookies", "", "cookies.txt file or Cookie header of a logged in session, for VIP tracks"),
+		name:        flags.String("name-template", zing.DefaultNameTemplate, "Template of track filenames, using {{.Artist}}, {{.Title}}, {{.ID}} and, once enriched, {{.Album}}, {{.Genre}} and {{.Year}}"),
+	}
+}
+
+// albumURL returns the -url flag, or the first positional argument.
+func (f *albumFlags) albumURL() string {
+	if *f.url == "" {
+		return f.flags.Arg(0)
+	}
+	return *f.url
+}
+
+// level returns the log level asked for by -log-level and -v.
+func (f *albumFlags) level() log.Lvl {
+	if *f.verbose {
+		return log.LvlDebug
+	}
+	level, err := log.LvlFromString(*f.logLevel)
+	if err != nil {
+		log.Warn("Invalid log level, using error", "log_level", *f.logLevel)
+		return log.LvlError
+	}
+	return level
+}
+
+// setupLogging sends the logs at level or above to stderr.
+func setupLogging(level log.Lvl) {
+	zing.Logger.SetHandler(log.LvlFilterHandler(level, log.StderrHandler))
+	if level > log.LvlError {
+		level = log.LvlError
+	}
+	log.Root().SetHandler(log.LvlFilterHandler(level, log.StderrHandler))
+}
+
+// id3v1Usage documents the -id3v1 flag of the commands writing tags.
+const id3v1Usage = "Transliteration of the ID3v1 tag written for legacy players: ascii, viqr or none"
+
+// setID3v1 selects the transliteration of the ID3v1 tags written, by name. Unknown
+// names are logged.
+func setID3v1(name string) bool {
+	if name == "none" {
+		tags.V1Transliteration = nil
+		return true
+	}
+	transliterate, ok := tags.Transliterations[name]
+	if !ok {
+		log.Crit("Unknown ID3v1 transliteration", "id3v1", name)
+		return false
+	}
+	tags.V1Transliteration = transliterate
+	return true
+}
+
+// load parses the album and applies the item selection flags. Problems are logged.
+func (f *albumFlags) load() (*zing.Album, bool) {
+	zing.DefaultClient.Retry.MaxAttempts = *f.maxAttempts
+	if err := zing.SetNameTemplate(*f.name); err != nil {
+		log.Crit("Invalid name template", "name_template", *f.name, "error", err)
+		return nil, false
+	}
+	if *f.apiKey != "" && *f.apiSecret != "" {
+		zing.DefaultClient.API = api.NewClient(*f.apiKey, *f.apiSecret, *f.apiVersion)
+	}
+	if *f.cookies != "" {
+		jar, err := zing.LoadSession(*f.cookies)
+		if err != nil {
+			log.Crit("Unable to load session cookies", "error", err)
+			return nil, false
+		}
+		zing.DefaultClient.UseSession(jar)
+	}
+
+	zingURL := f.albumURL()
+	if zingURL == "" {
+		log.Crit("No album URL given")
+		return nil, false
+	}
+
+	if *f.cacheDir != "" {
+		cache, err := zing.NewDiskCache(*f.cacheDir)
+		if err != nil {
+			log.Crit("Unable to open album cache", "cache_dir", *f.cacheDir, "error", err)
+			return nil, false
+		}
+		zing.DefaultParser = zing.NewParser(cache, *f.cacheTTL)
+	}
+
+	sel, err := zing.ParseSelection(*f.items, *f.match, *f.exclude)
+	if err != nil {
+		log.Crit("Invalid item selection", "error", err)
+		return nil, false
+	}
+
+	album, err := zing.DefaultParser.Parse(context.Background(), zingURL)
+	if err == nil {
+		album, err = album.Select(sel)
+	}
+	if err != nil {
+		log.Crit("Unable to parse album", "zing_url", zingURL, "error", err)
+		return nil, false
+	}
+	return album, true
+}
+
+func serveCommand() (*flag.FlagSet, func() int) {
+	flags, serve := server.Command()
+	return flags, func() int {
+		if err := serve(); err != nil {
+			return 1
+		}
+		return 0
+	}
+}
+
+func configCommand() (*flag.FlagSet, func() int) {
+	flags := config.NewFlagSet("config", flag.ExitOnError)
+	return flags, func() int {
+		if flags.Arg(0) != "print" {
+			fmt.Fprintf(os.Stderr, "Usage: zing-dl config print [command...]\n")
+			return 2
+		}
+
+		names := flags.Args()[1:]
+		if len(names) == 0 {
+			for _, c := range commands {
+				if c.name != "config" {
+					names = append(names, c.name)
+				}
+			}
+		}
+
+		configPath := flags.Lookup(config.FlagName).Value.String()
+		for i, name := range names {
+			c, ok := lookupCommand(name)
+			if !ok || c.name == "config" {
+				fmt.Fprintf(os.Stderr, "zing-dl: unknown command %q\n", name)
+				return 2
+			}
 
-	zing.Logger.SetHandler(log.LvlFilterHandler(log.LvlDebug, log.StdoutHandler))
+			target, _ := c.setup()
+			target.Parse(nil)
+			if configPath != "" {
+				target.Set(config.FlagName, configPath)
+			}
+			sources, err := config.Apply(target)
+			if err != nil {
+				log.Crit("Unable to load config", "error", err)
+				return 1
+			}
 
-	zing.DownloadAlbum(*zingURL, *downloadDir)
+			if i > 0 {
+				fmt.Println()
+			}
+			config.Print(os.Stdout, target, sources)
+		}
+		return 0
+	}
 }
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Taik/zing-mp3/zing"
+)
+
+var errPickerAborted = errors.New("selection aborted")
+
+// stty runs stty against the terminal on stdin and returns its output.
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// terminalRows returns the height of the terminal, or a sensible default when unknown.
+func terminalRows() int {
+	size, err := stty("size")
+	if err == nil {
+		fields := strings.Fields(size)
+		if len(fields) == 2 {
+			if rows, err := strconv.Atoi(fields[0]); err == nil && rows > 0 {
+				return rows
+			}
+		}
+	}
+	return 24
+}
+
+// picker is a scrollable, filterable multi-select list of album items.
+type picker struct {
+	items    []zing.AlbumItem
+	selected []bool
+
+	filter    string
+	filtering bool
+	visible   []int // indexes into items matching filter
+	cursor    int   // position in visible
+	offset    int   // first visible row shown
+	rows      int
+}
+
+func newPicker(items []zing.AlbumItem) *picker {
+	p := &picker{
+		items:    items,
+		selected: make([]bool, len(items)),
+	}
+	p.applyFilter()
+	return p
+}
+
+func (p *picker) applyFilter() {
+	needle := strings.ToLower(p.filter)
+	p.visible = p.visible[:0]
+	for i, item := range p.items {
+		haystack := strings.ToLower(item.Artist + " - " + item.Title + " " + item.Name())
+		if strings.Contains(haystack, needle) {
+			p.visible = append(p.visible, i)
+		}
+	}
+	p.cursor = 0
+	p.offset = 0
+}
+
+func (p *picker) count() int {
+	n := 0
+	for _, s := range p.selected {
+		if s {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *picker) move(delta int) {
+	p.cursor += delta
+	if p.cursor >= len(p.visible) {
+		p.cursor = len(p.visible) - 1
+	}
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+}
+
+// toggleAll selects every visible item, or clears them if they are all selected already.
+func (p *picker) toggleAll() {
+	all := true
+	for _, i := range p.visible {
+		all = all && p.selected[i]
+	}
+	for _, i := range p.visible {
+		p.selected[i] = !all
+	}
+}
+
+func (p *picker) render(out io.Writer) {
+	listRows := p.rows - 4
+	if listRows < 1 {
+		listRows = 1
+	}
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+listRows {
+		p.offset = p.cursor - listRows + 1
+	}
+
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	// Raw mode leaves newline translation off, so every line ends in \r\n.
+	fmt.Fprint(w, "\x1b[H\x1b[2J")
+	fmt.Fprint(w, "up/down move, space toggle, a all, / filter, enter confirm, q quit\r\n")
+	if p.filtering {
+		fmt.Fprintf(w, "Filter: %s_\r\n", p.filter)
+	} else if p.filter != "" {
+		fmt.Fprintf(w, "Filter: %s\r\n", p.filter)
+	} else {
+		fmt.Fprint(w, "\r\n")
+	}
+
+	for row := p.offset; row < len(p.visible) && row < p.offset+listRows; row++ {
+		i := p.visible[row]
+		cursor, mark := " ", " "
+		if row == p.cursor {
+			cursor = ">"
+		}
+		if p.selected[i] {
+			mark = "x"
+		}
+		fmt.Fprintf(w, "%s [%s] %3d. %s - %s\r\n", cursor, mark, i+1, p.items[i].Artist, p.items[i].Title)
+	}
+	for row := len(p.visible) - p.offset; row < listRows; row++ {
+		fmt.Fprint(w, "\r\n")
+	}
+	fmt.Fprintf(w, "%d of %d selected, %d shown", p.count(), len(p.items), len(p.visible))
+}
+
+// escapeTimeout is how long to wait for the rest of an escape sequence. Its bytes may
+// arrive separately, over SSH especially, while a lone ESC is followed by nothing.
+const escapeTimeout = 100 * time.Millisecond
+
+// handle applies a key press and reports whether the user confirmed their selection.
+// next returns the following key if one arrives within escapeTimeout.
+func (p *picker) handle(key rune, next func() (rune, bool)) (bool, error) {
+	if key == 27 {
+		if code, ok := next(); ok {
+			// Arrow and paging keys arrive as escape sequences, e.g. ESC [ A.
+			if code == '[' || code == 'O' {
+				code, _ = next()
+			}
+			switch code {
+			case 'A':
+				p.move(-1)
+			case 'B':
+				p.move(1)
+			case '5':
+				next()
+				p.move(-(p.rows - 4))
+			case '6':
+				next()
+				p.move(p.rows - 4)
+			}
+			return false, nil
+		}
+	}
+
+	if p.filtering {
+		switch key {
+		case '\r', '\n':
+			p.filtering = false
+		case 27:
+			p.filtering = false
+			p.filter = ""
+			p.applyFilter()
+		case 127, 8:
+			if f := []rune(p.filter); len(f) > 0 {
+				p.filter = string(f[:len(f)-1])
+				p.applyFilter()
+			}
+		default:
+			if key >= ' ' {
+				p.filter += string(key)
+				p.applyFilter()
+			}
+		}
+		return false, nil
+	}
+
+	switch key {
+	case 'q', 3, 27:
+		return false, errPickerAborted
+	case '\r', '\n':
+		return true, nil
+	case 'k':
+		p.move(-1)
+	case 'j':
+		p.move(1)
+	case ' ':
+		if len(p.visible) > 0 {
+			i := p.visible[p.cursor]
+			p.selected[i] = !p.selected[i]
+			p.move(1)
+		}
+	case 'a':
+		p.toggleAll()
+	case '/':
+		p.filtering = true
+	}
+	return false, nil
+}
+
+// readKeys sends the runes read from r until it fails, then closes the channel. Keys
+// are read in the background so escape sequences can be read with a timeout.
+func readKeys(r *bufio.Reader) <-chan rune {
+	keys := make(chan rune)
+	go func() {
+		defer close(keys)
+		for {
+			key, _, err := r.ReadRune()
+			if err != nil {
+				return
+			}
+			keys <- key
+		}
+	}()
+	return keys
+}
+
+// chosen returns the selected items in album order.
+func (p *picker) chosen() []zing.AlbumItem {
+	items := []zing.AlbumItem{}
+	for i, s := range p.selected {
+		if s {
+			items = append(items, p.items[i])
+		}
+	}
+	return items
+}
+
+// pickItems lets the user choose items of album on the terminal, previews the files
+// which will be written into downloadDir and asks for confirmation. It returns an album
+// holding only the chosen items.
+func pickItems(album *zing.Album, downloadDir string) (*zing.Album, error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read terminal state: %v", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("unable to switch terminal to raw mode: %v", err)
+	}
+
+	keys := readKeys(bufio.NewReader(os.Stdin))
+	next := func() (rune, bool) {
+		select {
+		case key, ok := <-keys:
+			return key, ok
+		case <-time.After(escapeTimeout):
+			return 0, false
+		}
+	}
+	p := newPicker(album.Items)
+	p.rows = terminalRows()
+
+	// Use the alternate screen so the list disappears once a choice is made.
+	fmt.Fprint(os.Stdout, "\x1b[?1049h")
+	for {
+		p.render(os.Stdout)
+
+		key, ok := <-keys
+		if !ok {
+			err = errPickerAborted
+			break
+		}
+		var confirmed bool
+		confirmed, err = p.handle(key, next)
+		if confirmed || err != nil {
+			break
+		}
+	}
+	fmt.Fprint(os.Stdout, "\x1b[?1049l")
+	stty(state)
+	if err != nil {
+		return nil, err
+	}
+
+	items := p.chosen()
+	if len(items) == 0 {
+		return nil, errPickerAborted
+	}
+
+	fmt.Printf("%d tracks will be written to %s:\n", len(items), downloadDir)
+	for _, item := range items {
+		fmt.Printf("  %s\n", filepath.Join(downloadDir, item.Name()))
+	}
+	fmt.Print("Download? [y/N] ")
+	line := []rune{}
+	for key := range keys {
+		if key == '\n' {
+			break
+		}
+		line = append(line, key)
+	}
+	answer := strings.ToLower(strings.TrimSpace(string(line)))
+	if answer != "y" && answer != "yes" {
+		return nil, errPickerAborted
+	}
+
+	picked := *album
+	picked.Items = items
+	return &picked, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Taik/zing-mp3/zing"
+)
+
+func testPicker() *picker {
+	p := newPicker([]zing.AlbumItem{
+		{Artist: "Sơn Tùng M-TP", Title: "Lạc Trôi"},
+		{Artist: "Sơn Tùng M-TP", Title: "Chạy Ngay Đi"},
+		{Artist: "Hương Tràm", Title: "Em Gái Mưa"},
+		{Artist: "Karik", Title: "Người Lạ Ơi"},
+	})
+	p.rows = 10
+	return p
+}
+
+// keys returns a next func handing out the given keys, then reporting a timeout.
+func keys(runes ...rune) func() (rune, bool) {
+	return func() (rune, bool) {
+		if len(runes) == 0 {
+			return 0, false
+		}
+		key := runes[0]
+		runes = runes[1:]
+		return key, true
+	}
+}
+
+func titles(items []zing.AlbumItem) []string {
+	list := []string{}
+	for _, item := range items {
+		list = append(list, item.Title)
+	}
+	return list
+}
+
+func TestPickerFilter(t *testing.T) {
+	cases := map[string][]int{
+		"":          {0, 1, 2, 3},
+		"sơn tùng":  {0, 1},
+		"EM GÁI":    {2},
+		"karik - n": {3},
+		"nothing":   {},
+	}
+	for filter, want := range cases {
+		p := testPicker()
+		p.move(2)
+		p.filter = filter
+		p.applyFilter()
+		if !reflect.DeepEqual(p.visible, want) || p.cursor != 0 {
+			t.Errorf("filter %q: visible %v, cursor %d; want %v, 0", filter, p.visible, p.cursor, want)
+		}
+	}
+}
+
+func TestPickerMove(t *testing.T) {
+	p := testPicker()
+	for _, step := range []struct{ delta, want int }{{1, 1}, {5, 3}, {-1, 2}, {-10, 0}, {-1, 0}} {
+		p.move(step.delta)
+		if p.cursor != step.want {
+			t.Errorf("move(%d): cursor %d, want %d", step.delta, p.cursor, step.want)
+		}
+	}
+
+	p.filter = "nothing"
+	p.applyFilter()
+	p.move(1)
+	if p.cursor != 0 {
+		t.Errorf("cursor %d in an empty list, want 0", p.cursor)
+	}
+}
+
+func TestPickerToggleAll(t *testing.T) {
+	p := testPicker()
+	p.selected[0] = true
+	p.filter = "sơn tùng"
+	p.applyFilter()
+
+	p.toggleAll()
+	if want := []bool{true, true, false, false}; !reflect.DeepEqual(p.selected, want) {
+		t.Errorf("first toggle selected %v, want %v", p.selected, want)
+	}
+	p.toggleAll()
+	if want := []bool{false, false, false, false}; !reflect.DeepEqual(p.selected, want) {
+		t.Errorf("second toggle selected %v, want %v", p.selected, want)
+	}
+}
+
+func TestPickerChosen(t *testing.T) {
+	p := testPicker()
+	if got := p.chosen(); len(got) != 0 {
+		t.Errorf("chosen = %v, want none", titles(got))
+	}
+	p.selected[3], p.selected[1] = true, true
+	if got, want := titles(p.chosen()), []string{"Chạy Ngay Đi", "Người Lạ Ơi"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chosen = %v, want %v in album order", got, want)
+	}
+}
+
+func TestPickerEscapeSequences(t *testing.T) {
+	p := testPicker()
+
+	// The rest of the sequence arrives after the ESC, as it does over slow links.
+	if _, err := p.handle(27, keys('[', 'B')); err != nil || p.cursor != 1 {
+		t.Errorf("down arrow: cursor %d, error %v", p.cursor, err)
+	}
+	if _, err := p.handle(27, keys('O', 'A')); err != nil || p.cursor != 0 {
+		t.Errorf("up arrow in application mode: cursor %d, error %v", p.cursor, err)
+	}
+	if _, err := p.handle(27, keys('[', '6', '~')); err != nil || p.cursor != 3 {
+		t.Errorf("page down: cursor %d, error %v", p.cursor, err)
+	}
+
+	// A lone ESC clears the filter while filtering and quits otherwise.
+	p.filtering, p.filter = true, "karik"
+	if _, err := p.handle(27, keys()); err != nil || p.filtering || p.filter != "" {
+		t.Errorf("ESC while filtering: filtering %v, filter %q, error %v", p.filtering, p.filter, err)
+	}
+	if _, err := p.handle(27, keys()); err != errPickerAborted {
+		t.Errorf("lone ESC: error %v, want %v", err, errPickerAborted)
+	}
+}
@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Taik/zing-mp3/zing"
+)
+
+// trackState is what the progress displays know about a single item.
+type trackState struct {
+	index    int
+	name     string
+	started  time.Time
+	finished time.Time
+	bytes    int64
+	total    int64
+	done     bool
+	failed   bool
+	err      error
+}
+
+// fraction returns how far along the track is, between 0 and 1.
+func (t *trackState) fraction() float64 {
+	switch {
+	case t.done || t.failed:
+		return 1
+	case t.total > 0:
+		return float64(t.bytes) / float64(t.total)
+	}
+	return 0
+}
+
+// speed returns the track's download rate in bytes per second.
+func (t *trackState) speed(now time.Time) float64 {
+	elapsed := now.Sub(t.started).Seconds()
+	if t.started.IsZero() || elapsed <= 0 {
+		return 0
+	}
+	return float64(t.bytes) / elapsed
+}
+
+// tracker keeps the state of every item of an album in album order. Items are
+// matched by their index in the album, as URLs may be empty or repeated.
+type tracker struct {
+	mu      sync.Mutex
+	started time.Time
+	tracks  []*trackState
+	// announced is the number of items of the album given to reset; other items are
+	// added after them and kept in unknown by item key.
+	announced int
+	unknown   map[string]*trackState
+}
+
+func (t *tracker) reset(album *zing.Album) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.started = time.Now()
+	t.tracks = make([]*trackState, len(album.Items))
+	t.announced = len(album.Items)
+	t.unknown = nil
+	for i, item := range album.Items {
+		t.tracks[i] = &trackState{index: i + 1, name: item.Artist + " - " + item.Title, total: -1}
+	}
+}
+
+// itemKey identifies item among those reported for an album.
+func itemKey(item zing.AlbumItem) string {
+	return fmt.Sprintf("%d %s", item.Index, item.ItemURL)
+}
+
+// track returns the state for item, adding it if the album was never announced.
+// It must be called with t.mu held.
+func (t *tracker) track(item zing.AlbumItem) *trackState {
+	if item.Index > 0 && item.Index <= t.announced {
+		return t.tracks[item.Index-1]
+	}
+	if t.unknown == nil {
+		t.unknown = make(map[string]*trackState)
+	}
+	state, ok := t.unknown[itemKey(item)]
+	if !ok {
+		state = &trackState{index: len(t.tracks) + 1, name: item.Artist + " - " + item.Title, total: -1}
+		t.tracks = append(t.tracks, state)
+		t.unknown[itemKey(item)] = state
+	}
+	return state
+}
+
+func (t *tracker) start(item zing.AlbumItem) *trackState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.track(item)
+	state.started = time.Now()
+	return state
+}
+
+func (t *tracker) progress(item zing.AlbumItem, bytes, total int64) *trackState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.track(item)
+	state.bytes = bytes
+	state.total = total
+	return state
+}
+
+func (t *tracker) finish(result zing.ItemResult) *trackState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.track(result.Item)
+	state.bytes = result.Bytes
+	state.err = result.Err
+	state.failed = result.Err != nil
+	state.done = result.Err == nil
+	state.finished = time.Now()
+	return state
+}
+
+func formatBytes(n float64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	i := 0
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0f %s", n, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
+
+func formatETA(d time.Duration) string {
+	if d <= 0 {
+		return "--:--"
+	}
+	d = (d + time.Second/2) / time.Second * time.Second
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+func bar(fraction float64, width int) string {
+	filled := int(fraction * float64(width))
+	if filled > width {
+		filled = width
+	}
+	return "[" + strings.Repeat("=", filled) + strings.Repeat(" ", width-filled) + "]"
+}
+
+func truncate(s string, width int) string {
+	r := []rune(s)
+	if len(r) <= width {
+		return s + strings.Repeat(" ", width-len(r))
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// ttyProgress redraws an album summary line in place, above a bar for each track in
+// progress and, as far as the terminal has room, the tracks finished most recently.
+type ttyProgress struct {
+	tracker
+	out  io.Writer
+	rows int
+
+	drawMu sync.Mutex
+	lines  int
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func newTTYProgress(out io.Writer) *ttyProgress {
+	p := &ttyProgress{
+		out:  out,
+		rows: terminalRows(),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go p.loop()
+	return p
+}
+
+func (p *ttyProgress) loop() {
+	defer close(p.done)
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.draw()
+		case <-p.stop:
+			p.draw()
+			return
+		}
+	}
+}
+
+// Close stops the redraw loop after a final frame.
+func (p *ttyProgress) Close() {
+	close(p.stop)
+	<-p.done
+}
+
+// byFinished sorts tracks by when they finished, latest first.
+type byFinished []*trackState
+
+func (s byFinished) Len() int           { return len(s) }
+func (s byFinished) Less(i, j int) bool { return s[i].finished.After(s[j].finished) }
+func (s byFinished) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// shownTracks picks the tracks to draw in at most max lines: those in progress, then
+// those finished most recently, in album order.
+func shownTracks(tracks []*trackState, max int) []*trackState {
+	shown := make(map[*trackState]bool)
+	finished := []*trackState{}
+	for _, t := range tracks {
+		switch {
+		case t.done || t.failed:
+			finished = append(finished, t)
+		case !t.started.IsZero() && len(shown) < max:
+			shown[t] = true
+		}
+	}
+	sort.Sort(byFinished(finished))
+	for _, t := range finished {
+		if len(shown) >= max {
+			break
+		}
+		shown[t] = true
+	}
+
+	list := make([]*trackState, 0, len(shown))
+	for _, t := range tracks {
+		if shown[t] {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+func (p *ttyProgress) draw() {
+	p.mu.Lock()
+	now := time.Now()
+
+	var sum float64
+	var received int64
+	done, failed, active := 0, 0, 0
+	for _, t := range p.tracks {
+		sum += t.fraction()
+		received += t.bytes
+		switch {
+		case t.failed:
+			failed++
+		case t.done:
+			done++
+		case !t.started.IsZero():
+			active++
+		}
+	}
+
+	// Leave a row for the cursor, so the frame never scrolls and the redraw stays in place.
+	lines := []string{}
+	for _, t := range shownTracks(p.tracks, p.rows-2) {
+		status := ""
+		switch {
+		case t.failed:
+			status = "failed: " + t.err.Error()
+		case t.done:
+			status = "done " + formatBytes(float64(t.bytes))
+		default:
+			speed := t.speed(now)
+			eta := time.Duration(0)
+			if t.total > 0 && speed > 0 {
+				eta = time.Duration(float64(t.total-t.bytes) / speed * float64(time.Second))
+			}
+			status = fmt.Sprintf("%3.0f%% %s/s ETA %s", t.fraction()*100, formatBytes(speed), formatETA(eta))
+		}
+		lines = append(lines, fmt.Sprintf("%3d. %s %s %s", t.index, truncate(t.name, 32), bar(t.fraction(), 20), status))
+	}
+
+	if len(p.tracks) > 0 {
+		fraction := sum / float64(len(p.tracks))
+		elapsed := now.Sub(p.started)
+		eta := time.Duration(0)
+		if fraction > 0 && fraction < 1 {
+			eta = time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+		}
+		speed := 0.0
+		if elapsed > 0 {
+			speed = float64(received) / elapsed.Seconds()
+		}
+		lines = append(lines, fmt.Sprintf("     %s %s %3.0f%% %d/%d done, %d active, %d failed, %s at %s/s ETA %s",
+			truncate("Album", 32), bar(fraction, 20), fraction*100,
+			done, len(p.tracks), active, failed, formatBytes(float64(received)), formatBytes(speed), formatETA(eta)))
+	}
+	p.mu.Unlock()
+
+	p.drawMu.Lock()
+	defer p.drawMu.Unlock()
+
+	frame := &bytes.Buffer{}
+	if p.lines > 0 {
+		fmt.Fprintf(frame, "\x1b[%dA", p.lines)
+	}
+	for _, line := range lines {
+		frame.WriteString("\r\x1b[2K" + line + "\n")
+	}
+	// Clear what is left of a taller previous frame.
+	frame.WriteString("\r\x1b[J")
+	frame.WriteTo(p.out)
+	p.lines = len(lines)
+}
+
+// AlbumParsed implements zing.Observer.
+func (p *ttyProgress) AlbumParsed(album *zing.Album) { p.reset(album) }
+
+// ItemStarted implements zing.Observer.
+func (p *ttyProgress) ItemStarted(item zing.AlbumItem) { p.start(item) }
+
+// Progress implements zing.Observer.
+func (p *ttyProgress) Progress(item zing.AlbumItem, bytes, total int64) {
+	p.progress(item, bytes, total)
+}
+
+// ItemTagged implements zing.Observer.
+func (p *ttyProgress) ItemTagged(item zing.AlbumItem, path string) {}
+
+// ItemDone implements zing.Observer.
+func (p *ttyProgress) ItemDone(result zing.ItemResult) { p.finish(result) }
+
+// ItemFailed implements zing.Observer.
+func (p *ttyProgress) ItemFailed(result zing.ItemResult) { p.finish(result) }
+
+// lineProgress prints a plain line whenever a track starts or finishes,
+// for output which is not a terminal.
+type lineProgress struct {
+	zing.NopObserver
+	tracker
+	out io.Writer
+}
+
+// AlbumParsed implements zing.Observer.
+func (p *lineProgress) AlbumParsed(album *zing.Album) {
+	p.reset(album)
+	fmt.Fprintf(p.out, "Album with %d items\n", len(album.Items))
+}
+
+// ItemStarted implements zing.Observer.
+func (p *lineProgress) ItemStarted(item zing.AlbumItem) {
+	t := p.start(item)
+	fmt.Fprintf(p.out, "%3d. %s: downloading\n", t.index, t.name)
+}
+
+// ItemDone implements zing.Observer.
+func (p *lineProgress) ItemDone(result zing.ItemResult) {
+	t := p.finish(result)
+	fmt.Fprintf(p.out, "%3d. %s: done, %s in %s\n",
+		t.index, t.name, formatBytes(float64(t.bytes)), time.Since(t.started)/time.Millisecond*time.Millisecond)
+}
+
+// ItemFailed implements zing.Observer.
+func (p *lineProgress) ItemFailed(result zing.ItemResult) {
+	t := p.finish(result)
+	fmt.Fprintf(p.out, "%3d. %s: failed after %d attempts: %s\n", t.index, t.name, len(result.Attempts), result.Err)
+}
+
+// jsonEvent is a single line written by jsonProgress.
+type jsonEvent struct {
+	Event    string          `json:"event"`
+	Time     time.Time       `json:"time"`
+	Album    *zing.Album     `json:"album,omitempty"`
+	Item     *zing.AlbumItem `json:"item,omitempty"`
+	Bytes    int64           `json:"bytes,omitempty"`
+	Total    int64           `json:"total,omitempty"`
+	Path     string          `json:"path,omitempty"`
+	Attempts int             `json:"attempts,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// jsonProgress writes every event as a JSON object per line. Progress events are
+// limited to one per item per progressInterval.
+type jsonProgress struct {
+	mu       sync.Mutex
+	enc      *json.Encoder
+	reported map[string]time.Time
+}
+
+const progressInterval = time.Second
+
+func newJSONProgress(out io.Writer) *jsonProgress {
+	return &jsonProgress{
+		enc:      json.NewEncoder(out),
+		reported: make(map[string]time.Time),
+	}
+}
+
+func (p *jsonProgress) emit(event jsonEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	event.Time = time.Now()
+	p.enc.Encode(event)
+}
+
+// AlbumParsed implements zing.Observer.
+func (p *jsonProgress) AlbumParsed(album *zing.Album) {
+	p.emit(jsonEvent{Event: "album_parsed", Album: album})
+}
+
+// ItemStarted implements zing.Observer.
+func (p *jsonProgress) ItemStarted(item zing.AlbumItem) {
+	p.emit(jsonEvent{Event: "item_started", Item: &item})
+}
+
+// Progress implements zing.Observer.
+func (p *jsonProgress) Progress(item zing.AlbumItem, bytes, total int64) {
+	p.mu.Lock()
+	last := p.reported[itemKey(item)]
+	due := time.Since(last) >= progressInterval || bytes == total
+	if due {
+		p.reported[itemKey(item)] = time.Now()
+	}
+	p.mu.Unlock()
+
+	if due {
+		p.emit(jsonEvent{Event: "progress", Item: &item, Bytes: bytes, Total: total})
+	}
+}
+
+// ItemTagged implements zing.Observer.
+func (p *jsonProgress) ItemTagged(item zing.AlbumItem, path string) {
+	p.emit(jsonEvent{Event: "item_tagged", Item: &item, Path: path})
+}
+
+// ItemDone implements zing.Observer.
+func (p *jsonProgress) ItemDone(result zing.ItemResult) {
+	p.emit(jsonEvent{
+		Event:    "item_done",
+		Item:     &result.Item,
+		Bytes:    result.Bytes,
+		Path:     result.Path,
+		Attempts: len(result.Attempts),
+	})
+}
+
+// ItemFailed implements zing.Observer.
+func (p *jsonProgress) ItemFailed(result zing.ItemResult) {
+	p.emit(jsonEvent{
+		Event:    "item_failed",
+		Item:     &result.Item,
+		Bytes:    result.Bytes,
+		Attempts: len(result.Attempts),
+		Error:    result.Err.Error(),
+	})
+}
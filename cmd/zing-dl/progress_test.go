@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Taik/zing-mp3/zing"
+)
+
+func TestTrackerMatchesItemsByIndex(t *testing.T) {
+	// Two items without a URL and two sharing one.
+	album := &zing.Album{Items: []zing.AlbumItem{
+		{Title: "A"}, {Title: "B"},
+		{Title: "C", ItemURL: "http://mp3.zing.vn/bai-hat/x.html"},
+		{Title: "D", ItemURL: "http://mp3.zing.vn/bai-hat/x.html"},
+	}}
+	tr := &tracker{}
+	tr.reset(album)
+	for i, item := range album.Items {
+		item.Index = i + 1
+		tr.progress(item, int64(i+1), 100)
+	}
+	for i, state := range tr.tracks {
+		if state.bytes != int64(i+1) {
+			t.Errorf("track %d has %d bytes, want %d", i+1, state.bytes, i+1)
+		}
+	}
+
+	// Items of an album which was never announced are added after the others.
+	tr.start(zing.AlbumItem{Title: "E", Index: 7})
+	tr.start(zing.AlbumItem{Title: "E", Index: 7})
+	if len(tr.tracks) != 5 || tr.tracks[4].index != 5 {
+		t.Errorf("%d tracks, want the unannounced item added once", len(tr.tracks))
+	}
+}
+
+func TestShownTracks(t *testing.T) {
+	now := time.Now()
+	tracks := []*trackState{}
+	for i := 1; i <= 100; i++ {
+		tracks = append(tracks, &trackState{index: i})
+	}
+	// 3 and 50 are in progress; 1, 2 and 10 finished in that order; the rest wait.
+	tracks[2].started, tracks[49].started = now, now
+	for i, index := range []int{1, 2, 10} {
+		track := tracks[index-1]
+		track.started, track.finished, track.done = now, now.Add(time.Duration(i)*time.Second), true
+	}
+	tracks[9].done, tracks[9].failed = false, true
+
+	cases := map[int][]int{
+		0:  {},
+		1:  {3},
+		4:  {2, 3, 10, 50},
+		10: {1, 2, 3, 10, 50},
+	}
+	for max, want := range cases {
+		got := []int{}
+		for _, track := range shownTracks(tracks, max) {
+			got = append(got, track.index)
+		}
+		if len(got) != len(want) {
+			t.Errorf("shownTracks(%d) = %v, want %v", max, got, want)
+			continue
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("shownTracks(%d) = %v, want %v", max, got, want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Taik/zing-mp3/config"
+	"github.com/Taik/zing-mp3/provider"
+	"github.com/Taik/zing-mp3/zing"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+func searchCommand() (*flag.FlagSet, func() int) {
+	flags := config.NewFlagSet("search", flag.ExitOnError)
+	var (
+		providerName = flags.String("provider", zing.ProviderName, "Site to search: "+strings.Join(provider.Names(), ", "))
+		kind         = flags.String("kind", "song", "What to search for: song, album, artist or video")
+		limit        = flags.Int("limit", 20, "Maximum number of results shown (0 for all)")
+		jsonOutput   = flags.Bool("json", false, "Print the results as JSON")
+		download     = flags.Int("download", 0, "Download the result with this number")
+		downloadDir  = flags.String("dir", ".", "Directory to download into")
+		logLevel     = flags.String("log-level", "error", "Minimum level logged to stderr: debug, info, warn, error or crit")
+	)
+	return flags, func() int {
+		level, err := log.LvlFromString(*logLevel)
+		if err != nil {
+			level = log.LvlError
+		}
+		setupLogging(level)
+
+		query := strings.Join(flags.Args(), " ")
+		if query == "" {
+			fmt.Fprintf(os.Stderr, "Usage: zing-dl search [flags] <query>\n")
+			return 2
+		}
+		searchKind, err := provider.ParseSearchKind(*kind)
+		if err != nil {
+			log.Crit("Invalid search kind", "error", err)
+			return 2
+		}
+		p, ok := provider.Get(*providerName)
+		if !ok {
+			log.Crit("Unknown provider", "provider", *providerName, "providers", strings.Join(provider.Names(), ","))
+			return 2
+		}
+
+		results, err := p.Search(context.Background(), query, searchKind)
+		if err != nil {
+			log.Crit("Search failed", "query", query, "error", err)
+			return 1
+		}
+		if *limit > 0 && len(results) > *limit {
+			results = results[:*limit]
+		}
+
+		if *download > 0 {
+			if *download > len(results) {
+				log.Crit("No such result", "download", *download, "results", len(results))
+				return 1
+			}
+			result := results[*download-1]
+			if !result.Downloadable() {
+				log.Crit("Result cannot be downloaded", "kind", result.Kind, "url", result.URL)
+				return 1
+			}
+			c, _ := lookupCommand("download")
+			return c.run([]string{"-dir", *downloadDir, result.URL})
+		}
+
+		if *jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(results)
+			return 0
+		}
+
+		if len(results) == 0 {
+			fmt.Println("No results")
+			return 0
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "#\tTITLE\tARTIST\tID\tURL")
+		for i, result := range results {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", i+1, result.Title, result.Artist, result.ID, result.URL)
+		}
+		w.Flush()
+		return 0
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/Taik/zing-mp3/zing"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+func tagCommand() (*flag.FlagSet, func() int) {
+	f := newAlbumFlags("tag")
+	downloadDir := f.flags.String("dir", ".", "Directory holding the downloaded tracks")
+	enrich := f.flags.Bool("enrich", true, "Look up album, genre, year, composer and duration of each track before tagging")
+	skipArtwork := f.flags.Bool("skip-artwork", false, "Neither embed cover art nor save it as "+zing.ArtworkName)
+	artworkSize := f.flags.Int("artwork-size", zing.DefaultArtworkSize, "Largest width or height of cover art, scaling larger covers down (0 keeps them as served)")
+	id3v1 := f.flags.String("id3v1", "ascii", id3v1Usage)
+	return f.flags, func() int {
+		setupLogging(f.level())
+		if !setID3v1(*id3v1) {
+			return 2
+		}
+		zing.DefaultClient.SkipArtwork = *skipArtwork
+		zing.DefaultClient.ArtworkSize = *artworkSize
+
+		album, ok := f.load()
+		if !ok {
+			return 1
+		}
+		ctx := context.Background()
+		if *enrich {
+			zing.NewEnricher(zing.DefaultClient).Enrich(ctx, album)
+		}
+
+		cover := album.CoverURL()
+		if !*skipArtwork && cover != "" {
+			path, err := zing.DefaultClient.SaveArtwork(ctx, cover, *downloadDir)
+			if err != nil {
+				log.Warn("Unable to save album artwork", "artwork_url", cover, "error", err)
+			} else {
+				fmt.Printf("Saved %s\n", path)
+			}
+		}
+
+		failed := 0
+		for _, item := range album.Items {
+			artworkURL := item.ArtworkURL()
+			if artworkURL == "" {
+				artworkURL = cover
+			}
+			path, err := zing.DefaultClient.TagItem(ctx, item, *downloadDir, artworkURL)
+			if err != nil {
+				failed++
+				log.Error("Unable to tag item", "file_path", path, "error", err)
+				continue
+			}
+			fmt.Printf("Tagged %s\n", path)
+		}
+		if failed > 0 {
+			return 1
+		}
+		return 0
+	}
+}
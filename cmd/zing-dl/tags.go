@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	// Registered so picture dimensions can be shown.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/Taik/zing-mp3/config"
+	"github.com/Taik/zing-mp3/tags"
+)
+
+// pictureTypes names the ID3v2 picture types worth telling apart.
+var pictureTypes = map[byte]string{
+	0x00: "other",
+	0x01: "file icon",
+	0x03: "front cover",
+	0x04: "back cover",
+	0x06: "media",
+	0x08: "artist",
+}
+
+// fileTags is the JSON form of a file's tags.
+type fileTags struct {
+	Path     string            `json:"path"`
+	Error    string            `json:"error,omitempty"`
+	Version  string            `json:"version,omitempty"`
+	V1       bool              `json:"id3v1,omitempty"`
+	Artist   string            `json:"artist,omitempty"`
+	Title    string            `json:"title,omitempty"`
+	Album    string            `json:"album,omitempty"`
+	Genre    string            `json:"genre,omitempty"`
+	Year     string            `json:"year,omitempty"`
+	Composer string            `json:"composer,omitempty"`
+	Duration float64           `json:"duration_seconds,omitempty"`
+	Frames   map[string]string `json:"frames,omitempty"`
+	UserText map[string]string `json:"user_text,omitempty"`
+	Comments []tags.Comment    `json:"comments,omitempty"`
+	Lyrics   []tags.Comment    `json:"lyrics,omitempty"`
+	Pictures []pictureInfo     `json:"pictures,omitempty"`
+}
+
+type pictureInfo struct {
+	MIMEType    string `json:"mime_type"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Bytes       int    `json:"bytes"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+}
+
+func newPictureInfo(picture tags.Picture) pictureInfo {
+	info := pictureInfo{
+		MIMEType:    picture.MIMEType,
+		Type:        pictureTypes[picture.Type],
+		Description: picture.Description,
+		Bytes:       len(picture.Data),
+	}
+	if info.Type == "" {
+		info.Type = fmt.Sprintf("type %d", picture.Type)
+	}
+	if config, _, err := image.DecodeConfig(bytes.NewReader(picture.Data)); err == nil {
+		info.Width, info.Height = config.Width, config.Height
+	}
+	return info
+}
+
+func newFileTags(path string, meta *tags.Metadata) fileTags {
+	t := fileTags{
+		Path:     path,
+		Version:  meta.Version,
+		V1:       meta.V1,
+		Artist:   meta.Artist,
+		Title:    meta.Title,
+		Album:    meta.Album,
+		Genre:    meta.Genre,
+		Year:     meta.Year,
+		Composer: meta.Composer,
+		Duration: meta.Duration.Seconds(),
+		Frames:   meta.Frames,
+		UserText: meta.UserText,
+		Comments: meta.Comments,
+		Lyrics:   meta.Lyrics,
+	}
+	for _, picture := range meta.Pictures {
+		t.Pictures = append(t.Pictures, newPictureInfo(picture))
+	}
+	return t
+}
+
+func tagsCommand() (*flag.FlagSet, func() int) {
+	flags := config.NewFlagSet("tags", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "Print the tags as JSON")
+	return flags, func() int {
+		if flags.Arg(0) != "show" {
+			fmt.Fprintf(os.Stderr, "Usage: zing-dl tags show [-json] file...\n")
+			return 2
+		}
+		// Flags may also follow the subcommand.
+		flags.Parse(flags.Args()[1:])
+		if flags.NArg() == 0 {
+			fmt.Fprintf(os.Stderr, "Usage: zing-dl tags show [-json] file...\n")
+			return 2
+		}
+
+		status := 0
+		files := []fileTags{}
+		for _, path := range flags.Args() {
+			meta, err := tags.Read(path)
+			if err != nil {
+				status = 1
+				files = append(files, fileTags{Path: path, Error: err.Error()})
+				continue
+			}
+			files = append(files, newFileTags(path, meta))
+		}
+
+		if *jsonOutput {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			enc.Encode(files)
+			return status
+		}
+
+		for i, file := range files {
+			if i > 0 {
+				fmt.Println()
+			}
+			printFileTags(file)
+		}
+		return status
+	}
+}
+
+// printFileTags prints one file's tags as a two column table.
+func printFileTags(file fileTags) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+
+	row := func(field, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s\t%s\n", field, value)
+		}
+	}
+	row("FILE", file.Path)
+	if file.Error != "" {
+		row("ERROR", file.Error)
+		return
+	}
+
+	version := "ID3v" + file.Version
+	if file.V1 && !strings.HasPrefix(file.Version, "1.") {
+		version += " + ID3v1"
+	}
+	row("VERSION", version)
+	row("ARTIST", file.Artist)
+	row("TITLE", file.Title)
+	row("ALBUM", file.Album)
+	row("GENRE", file.Genre)
+	row("YEAR", file.Year)
+	row("COMPOSER", file.Composer)
+	if file.Duration > 0 {
+		row("DURATION", fmt.Sprintf("%d:%02d", int(file.Duration)/60, int(file.Duration)%60))
+	}
+
+	for _, id := range sortedKeys(file.Frames) {
+		row(id, file.Frames[id])
+	}
+	for _, desc := range sortedKeys(file.UserText) {
+		row("TXXX:"+desc, file.UserText[desc])
+	}
+	for _, comment := range file.Comments {
+		row(commentField("COMM", comment), oneLine(comment.Text))
+	}
+	for _, lyrics := range file.Lyrics {
+		lines := strings.Count(strings.TrimSpace(lyrics.Text), "\n") + 1
+		row(commentField("USLT", lyrics), fmt.Sprintf("%d lines", lines))
+	}
+	for _, picture := range file.Pictures {
+		value := fmt.Sprintf("%s, %s, %d bytes", picture.Type, picture.MIMEType, picture.Bytes)
+		if picture.Width > 0 {
+			value += fmt.Sprintf(", %dx%d", picture.Width, picture.Height)
+		}
+		if picture.Description != "" {
+			value += fmt.Sprintf(", %q", picture.Description)
+		}
+		row("APIC", value)
+	}
+}
+
+func commentField(id string, comment tags.Comment) string {
+	field := id
+	if comment.Language != "" {
+		field += "[" + comment.Language + "]"
+	}
+	if comment.Description != "" {
+		field += ":" + comment.Description
+	}
+	return field
+}
+
+// oneLine keeps multi-line values from breaking the table.
+func oneLine(text string) string {
+	return strings.Replace(strings.TrimSpace(text), "\n", " / ", -1)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
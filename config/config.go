@@ -0,0 +1,193 @@
+// Package config fills command line flags from a configuration file and ZING_*
+// environment variables, so zing-dl and the web server share one way of being configured.
+//
+// Every flag can be set in three places, in order of precedence:
+//
+//	-port=8080                  on the command line
+//	ZING_SERVE_PORT=8080        or ZING_PORT=8080 in the environment
+//	port = 8080                 under [serve], or at the top level, of the config file
+//
+// Keys are the flag names; sections are command names. The file is TOML unless its
+// name ends in .yaml or .yml.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FlagName is the flag every command uses to point at its config file.
+const FlagName = "config"
+
+// NewFlagSet returns a flag set for the named command with the -config flag defined.
+func NewFlagSet(name string, handling flag.ErrorHandling) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, handling)
+	flags.String(FlagName, "", "Config file (defaults to $ZING_CONFIG or ~/.config/zing/config.toml)")
+	return flags
+}
+
+// DefaultPath returns the config file used when none is given, or "" if there is none.
+func DefaultPath() string {
+	if path := os.Getenv("ZING_CONFIG"); path != "" {
+		return path
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home := os.Getenv("HOME")
+		if home == "" {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	for _, name := range []string{"config.toml", "config.yaml", "config.yml"} {
+		path := filepath.Join(dir, "zing", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// load reads the config file at path.
+func load(path string) (values, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var v values
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		v, err = parseYAML(fd)
+	default:
+		v, err = parseTOML(fd)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return v, nil
+}
+
+// envName returns the environment variable for key, e.g. ZING_SERVE_MAX_ATTEMPTS.
+func envName(parts ...string) string {
+	name := "ZING"
+	for _, part := range parts {
+		name += "_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(part))
+	}
+	return name
+}
+
+// Sources records where the effective value of each flag came from.
+type Sources map[string]string
+
+// Apply sets every flag of a parsed flag set which was not given on the command line
+// from the environment or the config file, and returns where each value came from.
+func Apply(flags *flag.FlagSet) (Sources, error) {
+	sources := Sources{}
+	flags.VisitAll(func(f *flag.Flag) {
+		sources[f.Name] = "default"
+	})
+	flags.Visit(func(f *flag.Flag) {
+		sources[f.Name] = "flag"
+	})
+
+	path := DefaultPath()
+	if f := flags.Lookup(FlagName); f != nil && f.Value.String() != "" {
+		path = f.Value.String()
+	}
+	file := values{}
+	if path != "" {
+		var err error
+		file, err = load(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err != nil || sources[f.Name] == "flag" || f.Name == FlagName {
+			return
+		}
+
+		for _, env := range []string{envName(flags.Name(), f.Name), envName(f.Name)} {
+			if value, ok := os.LookupEnv(env); ok {
+				err = setFlag(f, value, env)
+				sources[f.Name] = env
+				return
+			}
+		}
+		for _, section := range []string{flags.Name(), ""} {
+			if value, ok := file[section][f.Name]; ok {
+				err = setFlag(f, value, path)
+				sources[f.Name] = path
+				return
+			}
+		}
+	})
+	return sources, err
+}
+
+func setFlag(f *flag.Flag, value, source string) error {
+	if err := f.Value.Set(value); err != nil {
+		return fmt.Errorf("invalid value %q for %s from %s: %v", value, f.Name, source, err)
+	}
+	return nil
+}
+
+// quote formats value the way Print writes it: numbers and booleans bare, everything else quoted.
+func quote(value string) string {
+	if _, err := strconv.ParseFloat(value, 64); err == nil {
+		return value
+	}
+	if value == "true" || value == "false" {
+		return value
+	}
+	return strconv.Quote(value)
+}
+
+// secretFlags hold credentials, which Print leaves out.
+var secretFlags = []string{"secret", "cookie", "password", "token", "api-key"}
+
+// Redacted replaces the values of secret flags in Print's output.
+const Redacted = "<redacted>"
+
+// isSecret reports whether the flag called name holds a credential.
+func isSecret(name string) bool {
+	for _, secret := range secretFlags {
+		if strings.Contains(name, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Print writes the effective values of flags as a config file section, noting
+// where each one came from. Set credentials such as -api-secret and -cookies are
+// shown as Redacted.
+func Print(w io.Writer, flags *flag.FlagSet, sources Sources) {
+	names := []string{}
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Name != FlagName {
+			names = append(names, f.Name)
+		}
+	})
+	sort.Strings(names)
+
+	fmt.Fprintf(w, "[%s]\n", flags.Name())
+	for _, name := range names {
+		value := flags.Lookup(name).Value.String()
+		if value != "" && isSecret(name) {
+			value = Redacted
+		}
+		fmt.Fprintf(w, "%s = %s # %s\n", name, quote(value), sources[name])
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.toml")
+	err = ioutil.WriteFile(path, []byte(`
+workers = 2
+dir = "/top"
+[download]
+dir = "/section"
+log-level = "warn"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flags := NewFlagSet("download", flag.ContinueOnError)
+	workers := flags.Int("workers", 8, "")
+	dirFlag := flags.String("dir", ".", "")
+	level := flags.String("log-level", "error", "")
+	quiet := flags.Bool("quiet", false, "")
+	untouched := flags.String("untouched", "default", "")
+	if err := flags.Parse([]string{"-config", path, "-log-level", "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("ZING_DOWNLOAD_QUIET", "true")
+	defer os.Unsetenv("ZING_DOWNLOAD_QUIET")
+	os.Setenv("ZING_WORKERS", "4")
+	defer os.Unsetenv("ZING_WORKERS")
+
+	sources, err := Apply(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := []struct {
+		name, got, want, source string
+	}{
+		{"log-level", *level, "debug", "flag"},
+		{"workers", flags.Lookup("workers").Value.String(), "4", "ZING_WORKERS"},
+		{"quiet", flags.Lookup("quiet").Value.String(), "true", "ZING_DOWNLOAD_QUIET"},
+		{"dir", *dirFlag, "/section", path},
+		{"untouched", *untouched, "default", "default"},
+	}
+	for _, c := range checks {
+		if c.got != c.want || sources[c.name] != c.source {
+			t.Errorf("%s = %q from %q, want %q from %q", c.name, c.got, sources[c.name], c.want, c.source)
+		}
+	}
+	if *workers != 4 || !*quiet {
+		t.Errorf("workers = %d, quiet = %v; want 4, true", *workers, *quiet)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	flags := NewFlagSet("serve", flag.ContinueOnError)
+	flags.String("api-key", "", "")
+	flags.String("api-secret", "", "")
+	flags.String("cookies", "", "")
+	flags.String("dir", ".", "")
+	err := flags.Parse([]string{"-api-key", "k3y", "-api-secret", "s3cret", "-cookies", "zmp3_rqid=abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	Print(out, flags, Sources{"api-key": "flag", "api-secret": "flag", "cookies": "flag", "dir": "default"})
+	for _, secret := range []string{"k3y", "s3cret", "zmp3_rqid"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("Print shows %q:\n%s", secret, out)
+		}
+	}
+	for _, line := range []string{
+		`api-secret = "` + Redacted + `" # flag`,
+		`dir = "." # default`,
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Print is missing %q:\n%s", line, out)
+		}
+	}
+}
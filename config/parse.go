@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// values holds settings by section and key. Top-level keys live in the "" section.
+type values map[string]map[string]string
+
+func (v values) set(section, key, value string) {
+	if v[section] == nil {
+		v[section] = make(map[string]string)
+	}
+	v[section][key] = value
+}
+
+// stripComment removes a trailing # comment which is not inside quotes. Quotes only
+// open at the start of a key, value or list item, so apostrophes in bare text such as
+// Don't are kept, and # only starts a comment at the start of the line or after
+// whitespace, as in both TOML and YAML.
+func stripComment(line string) string {
+	var quote, prev rune
+	escaped := false
+	for i, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case (r == '"' || r == '\'') && (i == 0 || strings.ContainsRune(" \t=:[,", prev)):
+			quote = r
+		case r == '#' && (i == 0 || prev == ' ' || prev == '\t'):
+			return line[:i]
+		}
+		prev = r
+	}
+	return line
+}
+
+// scalar decodes a quoted or bare value.
+func scalar(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if len(raw) >= 2 {
+		switch {
+		case raw[0] == '"' && raw[len(raw)-1] == '"':
+			return strconv.Unquote(raw)
+		case raw[0] == '\'' && raw[len(raw)-1] == '\'':
+			return raw[1 : len(raw)-1], nil
+		}
+	}
+	if strings.HasPrefix(raw, `"`) || strings.HasPrefix(raw, "'") {
+		return "", fmt.Errorf("unterminated string %s", raw)
+	}
+	return raw, nil
+}
+
+// list decodes an inline [a, b] list into a comma-separated value, as used by list flags.
+func list(raw string) (string, error) {
+	inner := strings.TrimSpace(raw[1 : len(raw)-1])
+	if inner == "" {
+		return "", nil
+	}
+	items := []string{}
+	for _, part := range strings.Split(inner, ",") {
+		item, err := scalar(part)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, item)
+	}
+	return strings.Join(items, ","), nil
+}
+
+func value(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "[") && strings.HasSuffix(raw, "]") {
+		return list(raw)
+	}
+	return scalar(raw)
+}
+
+// parseTOML reads the subset of TOML used by config files: [section] headers and
+// key = value pairs holding strings, numbers, booleans or inline lists.
+func parseTOML(r io.Reader) (values, error) {
+	v := values{}
+	section := ""
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, err := scalar(line[:i])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		val, err := value(line[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		v.set(section, key, val)
+	}
+	return v, scanner.Err()
+}
+
+// parseYAML reads the subset of YAML used by config files: top-level key: value pairs
+// and sections holding indented key: value pairs. Values may be scalars, inline lists
+// or block lists of "- item" lines.
+func parseYAML(r io.Reader) (values, error) {
+	v := values{}
+	section := ""
+	// listKey is the key whose block list is being read, if any.
+	listSection, listKey := "", ""
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimRight(stripComment(scanner.Text()), " \t")
+		line := strings.TrimSpace(text)
+		if line == "" || line == "---" {
+			continue
+		}
+		indented := text[0] == ' ' || text[0] == '\t'
+
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %d: list item outside of a list", n)
+			}
+			item, err := scalar(strings.TrimPrefix(line, "-"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n, err)
+			}
+			if prev := v[listSection][listKey]; prev != "" {
+				item = prev + "," + item
+			}
+			v.set(listSection, listKey, item)
+			continue
+		}
+		listKey = ""
+
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+		key, err := scalar(line[:i])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		raw := strings.TrimSpace(line[i+1:])
+
+		if !indented {
+			section = ""
+		}
+		if raw == "" {
+			if indented {
+				// A nested list under a section key.
+				listSection, listKey = section, key
+				v.set(section, key, "")
+				continue
+			}
+			// Either a section or a list; the following lines decide.
+			section = key
+			listSection, listKey = "", key
+			continue
+		}
+
+		val, err := value(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		v.set(section, key, val)
+	}
+	return v, scanner.Err()
+}
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStripComment(t *testing.T) {
+	cases := map[string]string{
+		`dir = "/music" # where tracks go`:  `dir = "/music" `,
+		`# a whole line`:                    ``,
+		`title = Don't Stop # the song`:     `title = Don't Stop `,
+		`title = Don't Stop`:                `title = Don't Stop`,
+		`url = http://host/page#anchor`:     `url = http://host/page#anchor`,
+		`match = "a # b"`:                   `match = "a # b"`,
+		`match = 'a # b' # c`:               `match = 'a # b' `,
+		`match = "say \"hi\" # b" # c`:      `match = "say \"hi\" # b" `,
+		`hosts = ['a', 'b#c'] # list`:       `hosts = ['a', 'b#c'] `,
+		`  - "it's # fine"`:                 `  - "it's # fine"`,
+		`name: Rock'n'Roll # yaml`:          `name: Rock'n'Roll `,
+		`color = #fff`:                      `color = `,
+	}
+	for line, want := range cases {
+		if got := stripComment(line); got != want {
+			t.Errorf("stripComment(%q) = %q, want %q", line, got, want)
+		}
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	got, err := parseTOML(strings.NewReader(`
+# Top level settings
+log-level = "info"
+workers = 8
+quiet = true
+
+[download]
+dir = '/home/me/Music' # quoted
+name-template = "{{.Artist}} - {{.Title}}"
+allowed-hosts = ["zing.vn", 'nixcdn.com', bare.example]
+match = Don't Stop
+empty = []
+
+[ serve ]
+"port" = 8080
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := values{
+		"": {
+			"log-level": "info",
+			"workers":   "8",
+			"quiet":     "true",
+		},
+		"download": {
+			"dir":           "/home/me/Music",
+			"name-template": "{{.Artist}} - {{.Title}}",
+			"allowed-hosts": "zing.vn,nixcdn.com,bare.example",
+			"match":         "Don't Stop",
+			"empty":         "",
+		},
+		"serve": {
+			"port": "8080",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, text := range []string{
+		"just a line",
+		`key = "unterminated`,
+		`key = "bad \q escape"`,
+	} {
+		if _, err := parseTOML(strings.NewReader(text)); err == nil {
+			t.Errorf("parseTOML(%q) succeeded", text)
+		}
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	got, err := parseYAML(strings.NewReader(`---
+# Top level settings
+log-level: info
+workers: 8
+hosts:
+  - zing.vn
+  - 'nixcdn.com' # comment
+  - "it's.example"
+
+download:
+  dir: /home/me/Music
+  match: Don't Stop
+  exclude: [1, "3-4"]
+  formats:
+    - zip
+    - tar
+serve:
+  port: 8080
+quiet: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := values{
+		"": {
+			"log-level": "info",
+			"workers":   "8",
+			"hosts":     "zing.vn,nixcdn.com,it's.example",
+			"quiet":     "true",
+		},
+		"download": {
+			"dir":     "/home/me/Music",
+			"match":   "Don't Stop",
+			"exclude": "1,3-4",
+			"formats": "zip,tar",
+		},
+		"serve": {
+			"port": "8080",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseYAML =\n%v\nwant\n%v", got, want)
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	for _, text := range []string{
+		"- orphan item",
+		"no colon here",
+		`key: "unterminated`,
+	} {
+		if _, err := parseYAML(strings.NewReader(text)); err == nil {
+			t.Errorf("parseYAML(%q) succeeded", text)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package nhaccuatui implements a provider for NhacCuaTui (nhaccuatui.com), whose player
+// reads an XML feed much like Zing's. Importing the package registers the provider.
+package nhaccuatui
+
+import (
+	"context"
+	"crypto/rc4"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/Taik/zing-mp3/provider"
+	"github.com/Taik/zing-mp3/zing"
+)
+
+// Name is the name the provider is registered under.
+const Name = "nhaccuatui"
+
+var (
+	// BaseURL is the site feeds and searches are requested from.
+	BaseURL = "https://www.nhaccuatui.com"
+
+	// DecryptKey is the RC4 key the player uses for encrypted feed fields.
+	DecryptKey = "Lyr1cjust4nct"
+
+	errNoFeed = errors.New("nhaccuatui: no player feed found")
+
+	xmlURLPattern = regexp.MustCompile(`xmlURL\s*=\s*["']([^"']+)["']`)
+	keyPattern    = regexp.MustCompile(`(key[12])=([0-9a-fA-F]{32})`)
+)
+
+func init() {
+	provider.Register(&Provider{})
+}
+
+// Provider resolves and searches NhacCuaTui. Requests go through a zing.Client, so
+// they share its retry policy, circuit breakers and session.
+type Provider struct {
+	// Client defaults to zing.DefaultClient.
+	Client *zing.Client
+}
+
+func (p *Provider) client() *zing.Client {
+	if p.Client == nil {
+		return zing.DefaultClient
+	}
+	return p.Client
+}
+
+// Name implements provider.Provider.
+func (p *Provider) Name() string {
+	return Name
+}
+
+// Match implements provider.Provider.
+func (p *Provider) Match(u *url.URL) bool {
+	return provider.MatchHost(u, "nhaccuatui.com", "nhaccuatui.vn")
+}
+
+// idFromURL returns the key in a page URL such as /playlist/ten-playlist.AbCd1234.html.
+func idFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	name := strings.TrimSuffix(path.Base(u.Path), ".html")
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// feed is the player's XML feed.
+type feed struct {
+	Tracks []feedTrack `xml:"track"`
+}
+
+type feedTrack struct {
+	Title    string `xml:"title"`
+	Creator  string `xml:"creator"`
+	Location string `xml:"location"`
+	Info     string `xml:"info"`
+	Lyric    string `xml:"lyric"`
+	Key      string `xml:"key"`
+	Cover    string `xml:"coverimage"`
+}
+
+// decrypt returns a feed field in clear text. Fields are either plain or the hex
+// encoding of their RC4 encryption with DecryptKey.
+func decrypt(field string) string {
+	field = strings.TrimSpace(field)
+	if field == "" || strings.HasPrefix(field, "http") {
+		return field
+	}
+	data, err := hex.DecodeString(field)
+	if err != nil {
+		return field
+	}
+	cipher, err := rc4.NewCipher([]byte(DecryptKey))
+	if err != nil {
+		return field
+	}
+	cipher.XORKeyStream(data, data)
+	return strings.TrimSpace(string(data))
+}
+
+// feedURL finds the URL of the player feed in the page at pageURL. Relative and
+// protocol-relative feed URLs are resolved against pageURL.
+func feedURL(pageURL *url.URL, page string) (string, error) {
+	if m := xmlURLPattern.FindStringSubmatch(page); m != nil {
+		u, err := url.Parse(m[1])
+		if err != nil {
+			return "", err
+		}
+		return pageURL.ResolveReference(u).String(), nil
+	}
+	if m := keyPattern.FindStringSubmatch(page); m != nil {
+		return BaseURL + "/flash/xml?html5=true&" + m[1] + "=" + m[2], nil
+	}
+	return "", errNoFeed
+}
+
+// Resolve implements provider.Provider. Song pages resolve to a single track.
+func (p *Provider) Resolve(ctx context.Context, rawURL string) (*provider.Collection, error) {
+	client := p.client()
+	pageURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var page []byte
+	_, err = client.Fetch(ctx, rawURL, func(response *http.Response) error {
+		var err error
+		page, err = ioutil.ReadAll(response.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	xmlURL, err := feedURL(pageURL, string(page))
+	if err != nil {
+		return nil, err
+	}
+	zing.Logger.Debug("Found NhacCuaTui feed URL", "url", rawURL, "feed_url", xmlURL)
+
+	playlist := feed{}
+	_, err = client.Fetch(ctx, xmlURL, func(response *http.Response) error {
+		playlist = feed{}
+		return xml.NewDecoder(response.Body).Decode(&playlist)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newCollection(rawURL, playlist), nil
+}
+
+// newCollection returns the tracks of a feed read for the page at rawURL, skipping
+// those without a location.
+func newCollection(rawURL string, playlist feed) *provider.Collection {
+	collection := &provider.Collection{
+		Provider: Name,
+		ID:       idFromURL(rawURL),
+		URL:      rawURL,
+	}
+	for _, t := range playlist.Tracks {
+		location := decrypt(t.Location)
+		if location == "" {
+			continue
+		}
+		info := decrypt(t.Info)
+		track := provider.Track{
+			ID:        strings.TrimSpace(t.Key),
+			Title:     strings.TrimSpace(t.Title),
+			Artist:    strings.TrimSpace(t.Creator),
+			URL:       info,
+			LyricsURL: decrypt(t.Lyric),
+			Sources: []provider.Source{{
+				URL:     location,
+				Quality: zing.PlayerQuality,
+				Format:  "mp3",
+			}},
+		}
+		if track.ID == "" {
+			track.ID = idFromURL(info)
+		}
+		if collection.ArtworkURL == "" {
+			collection.ArtworkURL = strings.TrimSpace(decrypt(t.Cover))
+		}
+		collection.Tracks = append(collection.Tracks, track)
+	}
+	return collection
+}
+
+// searchPages maps every kind to its search page and the path prefix of its results.
+var searchPages = map[provider.SearchKind][2]string{
+	provider.SearchTracks:      {"/tim-kiem/bai-hat", "/bai-hat/"},
+	provider.SearchCollections: {"/tim-kiem/playlist", "/playlist/"},
+	provider.SearchVideos:      {"/tim-kiem/mv", "/video/"},
+	provider.SearchArtists:     {"/tim-kiem/nghe-si", "/nghe-si-"},
+}
+
+// Search implements provider.Provider by reading the links of the site's search pages.
+func (p *Provider) Search(ctx context.Context, query string, kind provider.SearchKind) ([]provider.SearchResult, error) {
+	page, ok := searchPages[kind]
+	if !ok {
+		return nil, errors.New("nhaccuatui: unsupported search kind " + string(kind))
+	}
+
+	results := []provider.SearchResult{}
+	_, err := p.client().Fetch(ctx, BaseURL+page[0]+"?q="+url.QueryEscape(query), func(response *http.Response) error {
+		doc, err := goquery.NewDocumentFromResponse(response)
+		if err != nil {
+			return err
+		}
+
+		results = results[:0]
+		seen := make(map[string]bool)
+		doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+			href, _ := a.Attr("href")
+			u, err := response.Request.URL.Parse(href)
+			if err != nil || !strings.HasPrefix(u.Path, page[1]) || !strings.HasSuffix(u.Path, ".html") {
+				return
+			}
+			u.RawQuery, u.Fragment = "", ""
+
+			title, _ := a.Attr("title")
+			if title == "" {
+				title = a.Text()
+			}
+			title = strings.TrimSpace(title)
+			if title == "" || seen[u.String()] {
+				return
+			}
+			seen[u.String()] = true
+
+			result := provider.SearchResult{
+				Provider: Name,
+				Kind:     kind,
+				ID:       idFromURL(u.String()),
+				Title:    title,
+				URL:      u.String(),
+			}
+			if kind == provider.SearchArtists {
+				result.ID = strings.TrimSuffix(strings.TrimPrefix(u.Path, "/nghe-si-"), ".html")
+			} else {
+				artists := []string{}
+				a.Closest("li, div[class*=item], div[class*=box]").Find("a[href*='/nghe-si-']").Each(func(_ int, artist *goquery.Selection) {
+					if name := strings.TrimSpace(artist.Text()); name != "" {
+						artists = append(artists, name)
+					}
+				})
+				result.Artist = strings.Join(artists, ", ")
+			}
+			results = append(results, result)
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
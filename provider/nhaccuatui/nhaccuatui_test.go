@@ -0,0 +1,89 @@
+package nhaccuatui
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Taik/zing-mp3/zing"
+)
+
+func readTestdata(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestFeedURL(t *testing.T) {
+	pageURL, _ := url.Parse("https://www.nhaccuatui.com/bai-hat/em-gai-mua-huong-tram.rn2SAVYCnp8d.html")
+	cases := []struct {
+		page string
+		want string
+	}{
+		{string(readTestdata(t, "song.html")), "https://www.nhaccuatui.com/flash/xml?html5=true&key1=8bd1b1ea6c51f9e5b0a4f8a3ba6d8fd3"},
+		{string(readTestdata(t, "playlist_key.html")), BaseURL + "/flash/xml?html5=true&key2=4f7a1c0e9b2d3e8f6a5b4c3d2e1f0a9b"},
+		{`xmlURL = "https://www.nhaccuatui.com/flash/xml?key1=abc"`, "https://www.nhaccuatui.com/flash/xml?key1=abc"},
+		{`xmlURL = '/flash/xml?key1=abc'`, "https://www.nhaccuatui.com/flash/xml?key1=abc"},
+		{`xmlURL = "xml?key1=abc"`, "https://www.nhaccuatui.com/bai-hat/xml?key1=abc"},
+		{`xmlURL = "//stream.nhaccuatui.com/flash/xml?key1=abc"`, "https://stream.nhaccuatui.com/flash/xml?key1=abc"},
+	}
+	for _, c := range cases {
+		got, err := feedURL(pageURL, c.page)
+		if err != nil || got != c.want {
+			t.Errorf("feedURL(%.40q) = %q, %v, want %q", c.page, got, err, c.want)
+		}
+	}
+
+	if _, err := feedURL(pageURL, "<html></html>"); err != errNoFeed {
+		t.Errorf("page without a feed: error %v, want %v", err, errNoFeed)
+	}
+}
+
+func TestNewCollection(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "feed.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	playlist := feed{}
+	if err := xml.NewDecoder(f).Decode(&playlist); err != nil {
+		t.Fatal(err)
+	}
+
+	rawURL := "https://www.nhaccuatui.com/playlist/nhac-tre-hay-nhat.Ab12Cd34Ef56.html"
+	collection := newCollection(rawURL, playlist)
+	if collection.Provider != Name || collection.ID != "Ab12Cd34Ef56" || collection.URL != rawURL {
+		t.Errorf("collection %s %s at %s", collection.Provider, collection.ID, collection.URL)
+	}
+	if collection.ArtworkURL != "https://avatar-nct.nixcdn.com/song/2017/09/20/em-gai-mua.jpg" {
+		t.Errorf("artwork %q", collection.ArtworkURL)
+	}
+	if len(collection.Tracks) != 2 {
+		t.Fatalf("%d tracks, want the 2 with a location", len(collection.Tracks))
+	}
+
+	// The first track's location and info are encrypted and it has no key.
+	first := collection.Tracks[0]
+	if first.ID != "rn2SAVYCnp8d" || first.Title != "Em Gái Mưa" || first.Artist != "Hương Tràm" {
+		t.Errorf("first track %s %q by %q", first.ID, first.Title, first.Artist)
+	}
+	if first.URL != "https://www.nhaccuatui.com/bai-hat/em-gai-mua-huong-tram.rn2SAVYCnp8d.html" || first.LyricsURL != "https://lrc-nct.nixcdn.com/2017/09/20/em-gai-mua.lrc" {
+		t.Errorf("first track page %q, lyrics %q", first.URL, first.LyricsURL)
+	}
+	if len(first.Sources) != 1 || first.Sources[0].URL != "https://aredir.nixcdn.com/NhacCuaTui944/EmGaiMua-HuongTram.mp3" || first.Sources[0].Quality != zing.PlayerQuality {
+		t.Errorf("first track sources %+v", first.Sources)
+	}
+
+	second := collection.Tracks[1]
+	if second.ID != "Kk3fB9nQz1Wm" || second.Title != "Người Lạ Ơi" || second.Artist != "Karik, Orange" || second.LyricsURL != "" {
+		t.Errorf("second track %s %q by %q, lyrics %q", second.ID, second.Title, second.Artist, second.LyricsURL)
+	}
+	if len(second.Sources) != 1 || second.Sources[0].URL != "https://aredir.nixcdn.com/NhacCuaTui951/NguoiLaOi-KarikOrange.mp3" {
+		t.Errorf("second track sources %+v", second.Sources)
+	}
+}
@@ -0,0 +1,204 @@
+// Package provider defines a site-neutral model of tracks and collections, and a
+// registry of the providers able to resolve and search each music site.
+//
+// Providers register themselves from their package's init function, so a program
+// supports a site by importing the package implementing it. Package zing registers
+// the Zing MP3 provider.
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedURL is returned by Lookup when no registered provider handles a URL.
+var ErrUnsupportedURL = errors.New("no provider for url")
+
+// Source is a downloadable stream of a track.
+type Source struct {
+	URL string `json:"url"`
+	// Quality is the bitrate in kbps, e.g. "128", or a provider specific label.
+	Quality string `json:"quality"`
+	// Format is the file extension of the stream, e.g. "mp3".
+	Format string `json:"format"`
+}
+
+// Track is a single song.
+type Track struct {
+	ID        string   `json:"id"`
+	Title     string   `json:"title"`
+	Artist    string   `json:"artist"`
+	URL       string   `json:"url"`
+	LyricsURL string   `json:"lyrics_url,omitempty"`
+	Sources   []Source `json:"sources"`
+}
+
+// Source returns the track's source of the given quality, or its first source when
+// there is no such quality. ok is false when the track has no sources at all.
+func (t *Track) Source(quality string) (source Source, ok bool) {
+	for _, s := range t.Sources {
+		if s.Quality == quality {
+			return s, true
+		}
+	}
+	if len(t.Sources) > 0 {
+		return t.Sources[0], true
+	}
+	return Source{}, false
+}
+
+// Collection is an album, playlist or single track page resolved by a provider.
+type Collection struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+	Title    string `json:"title,omitempty"`
+	Artist   string `json:"artist,omitempty"`
+	URL      string `json:"url"`
+	// ArtworkURL is the collection's cover, if known.
+	ArtworkURL string  `json:"artwork_url,omitempty"`
+	Tracks     []Track `json:"tracks"`
+}
+
+// SearchKind is the type of thing searched for.
+type SearchKind string
+
+// Kinds of search results.
+const (
+	SearchTracks      SearchKind = "song"
+	SearchCollections SearchKind = "album"
+	SearchArtists     SearchKind = "artist"
+	SearchVideos      SearchKind = "video"
+)
+
+// ParseSearchKind returns the SearchKind named by s, accepting plurals such as "songs"
+// and "playlist" for albums.
+func ParseSearchKind(s string) (SearchKind, error) {
+	kind := SearchKind(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "s"))
+	switch kind {
+	case "playlist":
+		return SearchCollections, nil
+	case "track":
+		return SearchTracks, nil
+	case SearchTracks, SearchCollections, SearchArtists, SearchVideos:
+		return kind, nil
+	}
+	return "", fmt.Errorf("unknown search kind %q", s)
+}
+
+// SearchResult is a single match returned by a provider's Search.
+type SearchResult struct {
+	Provider string     `json:"provider"`
+	Kind     SearchKind `json:"kind"`
+	ID       string     `json:"id"`
+	Title    string     `json:"title"`
+	Artist   string     `json:"artist,omitempty"`
+	URL      string     `json:"url"`
+}
+
+// Downloadable reports whether the result can be passed to Resolve.
+func (r *SearchResult) Downloadable() bool {
+	return r.Kind != SearchArtists
+}
+
+// Provider resolves and searches a music site.
+type Provider interface {
+	// Name is a short, unique identifier such as "zing".
+	Name() string
+	// Match reports whether the provider handles u.
+	Match(u *url.URL) bool
+	// Resolve returns the tracks behind a URL matched by the provider.
+	Resolve(ctx context.Context, rawURL string) (*Collection, error)
+	// Search queries the site. Providers return an error for kinds they do not support.
+	Search(ctx context.Context, query string, kind SearchKind) ([]SearchResult, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]Provider)
+)
+
+// Register makes p available to Lookup and Get. It panics if a provider with the same
+// name is already registered.
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := providers[p.Name()]; dup {
+		panic("provider: Register called twice for " + p.Name())
+	}
+	providers[p.Name()] = p
+}
+
+// Get returns the provider registered under name.
+func Get(name string) (Provider, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[name]
+	return p, ok
+}
+
+// Names returns the names of every registered provider, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return sortedNames()
+}
+
+// Lookup returns the provider handling rawURL.
+func Lookup(rawURL string) (Provider, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return nil, err
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, name := range sortedNames() {
+		if providers[name].Match(u) {
+			return providers[name], nil
+		}
+	}
+	return nil, ErrUnsupportedURL
+}
+
+// sortedNames returns the registered names in order, which also keeps Lookup
+// deterministic should two providers match. It must be called with mu held.
+func sortedNames() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve resolves rawURL with the provider handling it.
+func Resolve(ctx context.Context, rawURL string) (*Collection, error) {
+	p, err := Lookup(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return p.Resolve(ctx, rawURL)
+}
+
+// MatchHost reports whether u is an http or https URL on one of domains or their subdomains.
+func MatchHost(u *url.URL, domains ...string) bool {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	host := strings.ToLower(u.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
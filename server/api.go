@@ -0,0 +1,109 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Taik/zing-mp3/zing"
+	"github.com/buaazp/fasthttprouter"
+	"github.com/valyala/fasthttp"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+// apiMaxAge is how long clients may reuse an album response without revalidating.
+const apiMaxAge = time.Minute
+
+type apiAlbumItem struct {
+	zing.AlbumItem
+	Filename string `json:"filename"`
+}
+
+type apiAlbum struct {
+	URL   string         `json:"url"`
+	Items []apiAlbumItem `json:"items"`
+}
+
+func renderAlbumJSON(zingURL string, album *zing.Album) ([]byte, error) {
+	resp := apiAlbum{
+		URL:   zingURL,
+		Items: make([]apiAlbumItem, 0, len(album.Items)),
+	}
+	for _, item := range album.Items {
+		resp.Items = append(resp.Items, apiAlbumItem{
+			AlbumItem: item,
+			Filename:  item.Name(),
+		})
+	}
+	return json.Marshal(resp)
+}
+
+func etagFor(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSONError(ctx *fasthttp.RequestCtx, statusCode int, err error) {
+	ctx.SetStatusCode(statusCode)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(map[string]string{
+		"error": err.Error(),
+	})
+}
+
+func apiAlbumHandler(ctx *fasthttp.RequestCtx, params fasthttprouter.Params) {
+	zingURL := string(ctx.QueryArgs().Peek("url"))
+	log.Info("Zing-mp3 album metadata request",
+		"zing_url", zingURL,
+	)
+
+	if !limits.Allow(ctx) {
+		return
+	}
+	if !limits.AllowedURL(zingURL) {
+		writeJSONError(ctx, fasthttp.StatusForbidden, errHostNotAllowed)
+		return
+	}
+
+	parseCtx, stop := requestContext(ctx)
+	album, err := albumParser.Parse(parseCtx, zingURL)
+	stop()
+	if err != nil {
+		writeJSONError(ctx, fasthttp.StatusBadRequest, err)
+		return
+	}
+
+	body, err := renderAlbumJSON(zingURL, album)
+	if err != nil {
+		writeJSONError(ctx, fasthttp.StatusInternalServerError, err)
+		return
+	}
+
+	etag := etagFor(body)
+	if etagMatches(string(ctx.Request.Header.Peek("If-None-Match")), etag) {
+		ctx.NotModified()
+	} else {
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		ctx.SetContentType("application/json")
+		ctx.SetBody(body)
+	}
+
+	ctx.Response.Header.Set("ETag", etag)
+	ctx.Response.Header.Set("Cache-Control",
+		fmt.Sprintf("max-age=%d", int(apiMaxAge.Seconds())),
+	)
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/Taik/zing-mp3/zing"
+)
+
+var errUnknownFormat = errors.New("unknown archive format")
+
+// ArchiveWriter bundles downloaded album items into a single output stream.
+type ArchiveWriter interface {
+	// WriteFile adds a new entry named filename with size bytes read from r.
+	WriteFile(filename string, size int64, r io.Reader) error
+	// Flush pushes any buffered data to the underlying writer.
+	Flush() error
+	// Close finalizes the archive. It does not close the underlying writer.
+	Close() error
+}
+
+// archiveFormat describes an output format supported by the album handler.
+type archiveFormat struct {
+	ContentType string
+	Extension   string
+
+	// NewWriter is set for formats that proxy the audio through the server.
+	NewWriter func(w io.Writer) ArchiveWriter
+	// WriteLinks is set for formats that only list the resolved download URLs.
+	WriteLinks func(w io.Writer, album *zing.Album) error
+}
+
+var archiveFormats = map[string]archiveFormat{
+	"zip": {
+		ContentType: "application/zip",
+		Extension:   "zip",
+		NewWriter:   newZipArchive,
+	},
+	"tar": {
+		ContentType: "application/x-tar",
+		Extension:   "tar",
+		NewWriter:   newTarArchive,
+	},
+	"tar.gz": {
+		ContentType: "application/gzip",
+		Extension:   "tar.gz",
+		NewWriter:   newTarGzArchive,
+	},
+	"m3u": {
+		ContentType: "audio/x-mpegurl",
+		Extension:   "m3u",
+		WriteLinks:  writeM3U,
+	},
+	"json": {
+		ContentType: "application/json",
+		Extension:   "json",
+		WriteLinks:  writeLinksJSON,
+	},
+}
+
+// lookupArchiveFormat returns the format registered under name, defaulting to zip.
+func lookupArchiveFormat(name string) (archiveFormat, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = "zip"
+	}
+	if name == "tgz" {
+		name = "tar.gz"
+	}
+
+	format, ok := archiveFormats[name]
+	if !ok {
+		return archiveFormat{}, errUnknownFormat
+	}
+	return format, nil
+}
+
+type zipArchive struct {
+	w *zip.Writer
+}
+
+func newZipArchive(w io.Writer) ArchiveWriter {
+	return &zipArchive{w: zip.NewWriter(w)}
+}
+
+func (z *zipArchive) WriteFile(filename string, size int64, r io.Reader) error {
+	f, err := z.w.Create(filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (z *zipArchive) Flush() error {
+	return z.w.Flush()
+}
+
+func (z *zipArchive) Close() error {
+	return z.w.Close()
+}
+
+type tarArchive struct {
+	w  *tar.Writer
+	gz *gzip.Writer
+}
+
+func newTarArchive(w io.Writer) ArchiveWriter {
+	return &tarArchive{w: tar.NewWriter(w)}
+}
+
+func newTarGzArchive(w io.Writer) ArchiveWriter {
+	gz := gzip.NewWriter(w)
+	return &tarArchive{w: tar.NewWriter(gz), gz: gz}
+}
+
+func (t *tarArchive) WriteFile(filename string, size int64, r io.Reader) error {
+	err := t.w.WriteHeader(&tar.Header{
+		Name:    filename,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(t.w, r)
+	return err
+}
+
+func (t *tarArchive) Flush() error {
+	err := t.w.Flush()
+	if err != nil {
+		return err
+	}
+	if t.gz != nil {
+		return t.gz.Flush()
+	}
+	return nil
+}
+
+func (t *tarArchive) Close() error {
+	err := t.w.Close()
+	if t.gz != nil {
+		if gzErr := t.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	return err
+}
+
+// albumLink is a single entry in the json link listing.
+type albumLink struct {
+	Title       string `json:"title"`
+	Artist      string `json:"artist"`
+	Filename    string `json:"filename"`
+	DownloadURL string `json:"download_url"`
+}
+
+func writeM3U(w io.Writer, album *zing.Album) error {
+	_, err := fmt.Fprintln(w, "#EXTM3U")
+	if err != nil {
+		return err
+	}
+
+	for _, item := range album.Items {
+		_, err = fmt.Fprintf(w, "#EXTINF:-1,%s - %s\n%s\n",
+			strings.TrimSpace(item.Artist),
+			strings.TrimSpace(item.Title),
+			item.DownloadURL,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeLinksJSON(w io.Writer, album *zing.Album) error {
+	links := make([]albumLink, 0, len(album.Items))
+	for _, item := range album.Items {
+		links = append(links, albumLink{
+			Title:       item.Title,
+			Artist:      item.Artist,
+			Filename:    item.Name(),
+			DownloadURL: item.DownloadURL,
+		})
+	}
+	return json.NewEncoder(w).Encode(links)
+}
@@ -0,0 +1,346 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Taik/zing-mp3/zing"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+var errCacheCorrupt = errors.New("cached audio failed integrity check")
+
+// audioCacheEntry maps a track key onto a content-addressed object.
+type audioCacheEntry struct {
+	Hash       string    `json:"hash"`
+	Size       int64     `json:"size"`
+	LastAccess time.Time `json:"last_access"`
+}
+
+// audioCacheStats are the counters reported to operators.
+type audioCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Stores    uint64 `json:"stores"`
+	Evictions uint64 `json:"evictions"`
+	Corrupt   uint64 `json:"corrupt"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	MaxBytes  int64  `json:"max_bytes"`
+}
+
+// audioCache is an on-disk, content-addressed store of downloaded tracks shared by all album jobs.
+// Objects are named by the SHA-256 of their contents, and an index maps track ID and quality onto them.
+type audioCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	index   map[string]*audioCacheEntry
+	objects map[string]int // hash -> number of index entries referencing it
+	readers map[string]int // hash -> number of Gets reading it; its file outlives its entries until they finish
+	size    int64
+	stats   audioCacheStats
+}
+
+// newAudioCache opens the cache in dir, evicting entries until it fits within maxBytes.
+func newAudioCache(dir string, maxBytes int64) (*audioCache, error) {
+	err := os.MkdirAll(filepath.Join(dir, "objects"), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &audioCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		index:    make(map[string]*audioCacheEntry),
+		objects:  make(map[string]int),
+		readers:  make(map[string]int),
+	}
+
+	data, err := ioutil.ReadFile(c.indexPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		index := make(map[string]*audioCacheEntry)
+		err = json.Unmarshal(data, &index)
+		if err != nil {
+			log.Warn("Discarding unreadable audio cache index", "error", err)
+		}
+		for key, entry := range index {
+			if entry == nil || !validObjectHash(entry.Hash) || entry.Size < 0 {
+				log.Warn("Dropping invalid audio cache entry", "key", key)
+				continue
+			}
+			info, err := os.Stat(c.objectPath(entry.Hash))
+			if err != nil || info.Size() != entry.Size {
+				continue
+			}
+			c.addLocked(key, entry)
+		}
+	}
+
+	c.mu.Lock()
+	c.evictLocked()
+	err = c.saveLocked()
+	c.mu.Unlock()
+	return c, err
+}
+
+// audioCacheKey returns the key under which item is cached, or "" if it can't be identified.
+func audioCacheKey(item *zing.AlbumItem, quality string) string {
+	id := item.ID()
+	if id == "" {
+		return ""
+	}
+	return id + "/" + quality
+}
+
+func (c *audioCache) indexPath() string {
+	return filepath.Join(c.dir, "index.json")
+}
+
+// validObjectHash reports whether hash is a hex encoded SHA-256, as object names are.
+func validObjectHash(hash string) bool {
+	if len(hash) != 2*sha256.Size {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+func (c *audioCache) objectPath(hash string) string {
+	return filepath.Join(c.dir, "objects", hash[:2], hash)
+}
+
+// Get copies the cached track stored under key into buf, verifying its checksum.
+// It reports false on a miss; corrupt objects are removed and reported as misses.
+func (c *audioCache) Get(key string, buf *bytes.Buffer) bool {
+	c.mu.Lock()
+	entry, ok := c.index[key]
+	if !ok {
+		c.stats.Misses++
+		c.mu.Unlock()
+		return false
+	}
+	entry.LastAccess = time.Now()
+	hash := entry.Hash
+	c.readers[hash]++
+	c.mu.Unlock()
+
+	err := c.readObject(hash, buf)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readers[hash]--
+	if c.readers[hash] <= 0 {
+		delete(c.readers, hash)
+		if c.objects[hash] == 0 {
+			// Evicted while being read.
+			os.Remove(c.objectPath(hash))
+		}
+	}
+	if err != nil {
+		log.Warn("Dropping unusable audio cache entry",
+			"key", key,
+			"hash", hash,
+			"error", err,
+		)
+		buf.Reset()
+
+		if err == errCacheCorrupt {
+			c.stats.Corrupt++
+		}
+		c.stats.Misses++
+		// The key may have been stored again meanwhile, which is left alone.
+		if c.index[key] == entry {
+			c.removeLocked(key)
+			c.saveLocked()
+		}
+		return false
+	}
+
+	c.stats.Hits++
+	return true
+}
+
+func (c *audioCache) readObject(hash string, buf *bytes.Buffer) error {
+	fd, err := os.Open(c.objectPath(hash))
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(buf, h), fd)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != hash {
+		return errCacheCorrupt
+	}
+	return nil
+}
+
+// Put stores data under key, evicting least recently used tracks to stay within the size limit.
+func (c *audioCache) Put(key string, data []byte) error {
+	if int64(len(data)) > c.maxBytes {
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	// The data is written out unlocked, but only moved into place under the lock, as
+	// removeLocked deletes objects under it too.
+	tmp, err := c.writeTemp(data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.index[key]; ok && entry.Hash == hash {
+		// Replacing the entry would drop the object's last reference and delete it.
+		entry.LastAccess = time.Now()
+		c.stats.Stores++
+		return c.saveLocked()
+	}
+	if c.objects[hash] == 0 {
+		path := c.objectPath(hash)
+		err = os.MkdirAll(filepath.Dir(path), os.ModePerm)
+		if err == nil {
+			err = os.Rename(tmp, path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	c.removeLocked(key)
+	c.stats.Stores++
+	c.addLocked(key, &audioCacheEntry{
+		Hash:       hash,
+		Size:       int64(len(data)),
+		LastAccess: time.Now(),
+	})
+	c.evictLocked()
+	return c.saveLocked()
+}
+
+// writeTemp writes data to a new temporary file in the cache directory and returns its path.
+func (c *audioCache) writeTemp(data []byte) (string, error) {
+	tmp, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+func (c *audioCache) addLocked(key string, entry *audioCacheEntry) {
+	c.index[key] = entry
+	if c.objects[entry.Hash] == 0 {
+		c.size += entry.Size
+	}
+	c.objects[entry.Hash]++
+}
+
+func (c *audioCache) removeLocked(key string) {
+	entry, ok := c.index[key]
+	if !ok {
+		return
+	}
+	delete(c.index, key)
+
+	c.objects[entry.Hash]--
+	if c.objects[entry.Hash] <= 0 {
+		delete(c.objects, entry.Hash)
+		c.size -= entry.Size
+		if c.readers[entry.Hash] == 0 {
+			os.Remove(c.objectPath(entry.Hash))
+		}
+	}
+}
+
+func (c *audioCache) evictLocked() {
+	if c.size <= c.maxBytes {
+		return
+	}
+
+	keys := make([]string, 0, len(c.index))
+	for key := range c.index {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.index[keys[i]].LastAccess.Before(c.index[keys[j]].LastAccess)
+	})
+
+	for _, key := range keys {
+		if c.size <= c.maxBytes {
+			break
+		}
+		log.Debug("Evicting track from audio cache", "key", key)
+		c.removeLocked(key)
+		c.stats.Evictions++
+	}
+}
+
+func (c *audioCache) saveLocked() error {
+	data, err := json.Marshal(c.index)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.indexPath())
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Error("Unable to save audio cache index", "error", err)
+	}
+	return err
+}
+
+// Stats returns a snapshot of the cache counters.
+func (c *audioCache) Stats() audioCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.index)
+	stats.Bytes = c.size
+	stats.MaxBytes = c.maxBytes
+	return stats
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func tempCacheDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "audiocache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestAudioCacheDropsInvalidEntries(t *testing.T) {
+	dir, cleanup := tempCacheDir(t)
+	defer cleanup()
+
+	data := []byte("track")
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	object := filepath.Join(dir, "objects", hash[:2], hash)
+	if err := os.MkdirAll(filepath.Dir(object), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(object, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	index := fmt.Sprintf(`{
+		"null": null,
+		"empty": {"hash": "", "size": 5},
+		"short": {"hash": "a", "size": 5},
+		"path": {"hash": "../../../../etc/passwd", "size": 5},
+		"good": {"hash": %q, "size": 5}
+	}`, hash)
+	if err := ioutil.WriteFile(filepath.Join(dir, "index.json"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newAudioCache(dir, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Stats().Entries; n != 1 {
+		t.Errorf("loaded %d entries, want 1", n)
+	}
+	buf := &bytes.Buffer{}
+	if !c.Get("good", buf) || buf.String() != "track" {
+		t.Errorf("Get(good) = %q, want %q", buf.String(), "track")
+	}
+}
+
+func TestAudioCacheConcurrentUse(t *testing.T) {
+	dir, cleanup := tempCacheDir(t)
+	defer cleanup()
+
+	// Keys share five distinct tracks, and only three fit, so entries are evicted
+	// and stored again while being read.
+	tracks := make([][]byte, 5)
+	for i := range tracks {
+		tracks[i] = bytes.Repeat([]byte{byte('a' + i)}, 1024)
+	}
+	track := func(key int) []byte { return tracks[key%len(tracks)] }
+
+	c, err := newAudioCache(dir, 3*1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			buf := &bytes.Buffer{}
+			for i := 0; i < 300; i++ {
+				key := (worker + i) % 12
+				name := fmt.Sprintf("track%d/320", key)
+				buf.Reset()
+				if c.Get(name, buf) {
+					if !bytes.Equal(buf.Bytes(), track(key)) {
+						t.Errorf("Get(%s) returned another track's data", name)
+						return
+					}
+					continue
+				}
+				if err := c.Put(name, track(key)); err != nil {
+					t.Errorf("Put(%s): %v", name, err)
+					return
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	if stats.Corrupt != 0 {
+		t.Errorf("%d corrupt reads", stats.Corrupt)
+	}
+	if stats.Bytes > stats.MaxBytes {
+		t.Errorf("cache holds %d bytes, more than its maximum of %d", stats.Bytes, stats.MaxBytes)
+	}
+
+	// Every indexed object is on disk, and nothing else is.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, entry := range c.index {
+		if _, err := os.Stat(c.objectPath(entry.Hash)); err != nil {
+			t.Errorf("object of %s: %v", key, err)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "objects", "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(c.objects) {
+		t.Errorf("%d object files for %d objects", len(files), len(c.objects))
+	}
+	temps, _ := filepath.Glob(filepath.Join(dir, ".tmp-*"))
+	if len(temps) != 0 {
+		t.Errorf("temporary files left behind: %v", temps)
+	}
+}
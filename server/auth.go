@@ -0,0 +1,376 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buaazp/fasthttprouter"
+	"github.com/valyala/fasthttp"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+var (
+	errUnauthorized  = errors.New("missing or invalid API key")
+	errLinkExpired   = errors.New("download link has expired")
+	errBadSignature  = errors.New("download link signature is invalid")
+	errQuotaExceeded = errors.New("daily quota exceeded for this API key")
+	errInvalidTTL    = errors.New("invalid ttl")
+)
+
+// accountUserValue is the RequestCtx user value holding the authenticated account name.
+const accountUserValue = "account"
+
+// apiAccount is a user of the web service, identified by one static API key.
+type apiAccount struct {
+	Name           string `json:"name"`
+	Key            string `json:"key"`
+	RequestsPerDay int    `json:"requests_per_day"`
+	MBPerDay       int64  `json:"mb_per_day"`
+}
+
+// authConfig is the JSON file loaded with -auth-config.
+type authConfig struct {
+	// SigningSecret is the HMAC key used for signed download links.
+	SigningSecret string       `json:"signing_secret"`
+	Accounts      []apiAccount `json:"accounts"`
+	// QuotaFile is where per-account usage is persisted between restarts.
+	QuotaFile string `json:"quota_file"`
+}
+
+// quotaUsage is an account's usage for a single day.
+type quotaUsage struct {
+	Day      string `json:"day"`
+	Requests int    `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// quotaStore tracks daily usage per account in a JSON file.
+type quotaStore struct {
+	path string
+
+	mu    sync.Mutex
+	usage map[string]*quotaUsage
+}
+
+func openQuotaStore(path string) (*quotaStore, error) {
+	q := &quotaStore{
+		path:  path,
+		usage: make(map[string]*quotaUsage),
+	}
+	if path == "" {
+		return q, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return q, json.Unmarshal(data, &q.usage)
+}
+
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// currentLocked returns today's usage for account, resetting it at the start of a new day.
+func (q *quotaStore) currentLocked(account string) *quotaUsage {
+	day := today()
+	usage, ok := q.usage[account]
+	if !ok || usage.Day != day {
+		usage = &quotaUsage{Day: day}
+		q.usage[account] = usage
+	}
+	return usage
+}
+
+// Request charges a request to account, failing if it is over either of its daily quotas.
+func (q *quotaStore) Request(account *apiAccount) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage := q.currentLocked(account.Name)
+	if account.RequestsPerDay > 0 && usage.Requests >= account.RequestsPerDay {
+		return errQuotaExceeded
+	}
+	if account.MBPerDay > 0 && usage.Bytes >= account.MBPerDay<<20 {
+		return errQuotaExceeded
+	}
+	usage.Requests++
+	return q.saveLocked()
+}
+
+// AddBytes charges n downloaded bytes to account.
+func (q *quotaStore) AddBytes(account string, n int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.currentLocked(account).Bytes += n
+	q.saveLocked()
+}
+
+func (q *quotaStore) saveLocked() error {
+	if q.path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(q.usage)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(q.path), ".quota-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), q.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Error("Unable to save quota usage", "quota_file", q.path, "error", err)
+	}
+	return err
+}
+
+// authenticator checks API keys and signed links. A nil authenticator lets everything through.
+type authenticator struct {
+	secret   []byte
+	accounts map[string]*apiAccount // by key
+	byName   map[string]*apiAccount
+	quotas   *quotaStore
+	// maxTTL caps how long links handed out by /api/sign stay valid; zero leaves them uncapped.
+	maxTTL time.Duration
+}
+
+func loadAuthenticator(path string) (*authenticator, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	config := authConfig{}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return nil, err
+	}
+	if config.SigningSecret == "" {
+		return nil, errors.New("auth config is missing signing_secret")
+	}
+
+	quotas, err := openQuotaStore(config.QuotaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &authenticator{
+		secret:   []byte(config.SigningSecret),
+		accounts: make(map[string]*apiAccount),
+		byName:   make(map[string]*apiAccount),
+		quotas:   quotas,
+	}
+	for i := range config.Accounts {
+		account := &config.Accounts[i]
+		if account.Key == "" || account.Name == "" {
+			return nil, errors.New("auth config accounts need both a name and a key")
+		}
+		a.accounts[account.Key] = account
+		a.byName[account.Name] = account
+	}
+	return a, nil
+}
+
+var auth *authenticator
+
+// lookupKey finds the account owning key in constant time with respect to the key's contents.
+func (a *authenticator) lookupKey(key string) *apiAccount {
+	var found *apiAccount
+	for k, account := range a.accounts {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			found = account
+		}
+	}
+	return found
+}
+
+// canonicalQuery renders args, minus the signature, in a stable order for signing.
+// Keys and values are escaped, so that no two queries share a canonical form.
+func canonicalQuery(args *fasthttp.Args) string {
+	pairs := []string{}
+	args.VisitAll(func(key, value []byte) {
+		if string(key) == "sig" {
+			return
+		}
+		pairs = append(pairs, url.QueryEscape(string(key))+"="+url.QueryEscape(string(value)))
+	})
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func (a *authenticator) sign(path, query string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(path))
+	mac.Write([]byte{'?'})
+	mac.Write([]byte(query))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignLink returns the query string for a link to path which is valid until expires and billed to account.
+func (a *authenticator) SignLink(path string, args *fasthttp.Args, account string, expires time.Time) string {
+	args.Del("sig")
+	args.Del("api_key")
+	args.Set("account", account)
+	args.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	args.Set("sig", a.sign(path, canonicalQuery(args)))
+	return args.String()
+}
+
+// verifySignedLink checks a request made with a signed link and returns the account it is billed to.
+func (a *authenticator) verifySignedLink(ctx *fasthttp.RequestCtx) (*apiAccount, error) {
+	args := ctx.QueryArgs()
+	expected := a.sign(string(ctx.Path()), canonicalQuery(args))
+	if !hmac.Equal([]byte(expected), args.Peek("sig")) {
+		return nil, errBadSignature
+	}
+
+	expires, err := strconv.ParseInt(string(args.Peek("expires")), 10, 64)
+	if err != nil {
+		return nil, errBadSignature
+	}
+	if time.Now().Unix() > expires {
+		return nil, errLinkExpired
+	}
+
+	account, ok := a.byName[string(args.Peek("account"))]
+	if !ok {
+		return nil, errBadSignature
+	}
+	return account, nil
+}
+
+// Authenticate identifies the account behind a request, via a signed link or an API key.
+func (a *authenticator) Authenticate(ctx *fasthttp.RequestCtx) (*apiAccount, error) {
+	if ctx.QueryArgs().Has("sig") {
+		return a.verifySignedLink(ctx)
+	}
+
+	account := a.lookupKey(requestAPIKey(ctx))
+	if account == nil {
+		return nil, errUnauthorized
+	}
+	return account, nil
+}
+
+// requireAuth wraps handle so it is only reachable with a valid API key or signed link.
+func requireAuth(handle fasthttprouter.Handle) fasthttprouter.Handle {
+	return func(ctx *fasthttp.RequestCtx, params fasthttprouter.Params) {
+		if auth == nil {
+			handle(ctx, params)
+			return
+		}
+
+		account, err := auth.Authenticate(ctx)
+		if err != nil {
+			log.Warn("Rejected unauthenticated request",
+				"path", string(ctx.Path()),
+				"error", err,
+			)
+			writeJSONError(ctx, fasthttp.StatusUnauthorized, err)
+			return
+		}
+
+		ctx.SetUserValue(accountUserValue, account.Name)
+		handle(ctx, params)
+	}
+}
+
+// chargeQuota wraps handle, which must also be wrapped by requireAuth, so each request is
+// charged to the account's quota. Only downloads are charged; previews, job polling and
+// link signing are free, as the rate limits already bound them.
+func chargeQuota(handle fasthttprouter.Handle) fasthttprouter.Handle {
+	return func(ctx *fasthttp.RequestCtx, params fasthttprouter.Params) {
+		if auth == nil {
+			handle(ctx, params)
+			return
+		}
+
+		account := auth.byName[requestAccount(ctx)]
+		if account == nil {
+			writeJSONError(ctx, fasthttp.StatusUnauthorized, errUnauthorized)
+			return
+		}
+		if err := auth.quotas.Request(account); err != nil {
+			writeJSONError(ctx, fasthttp.StatusTooManyRequests, err)
+			return
+		}
+		handle(ctx, params)
+	}
+}
+
+// requestAccount returns the name of the authenticated account, or "" when auth is disabled.
+func requestAccount(ctx *fasthttp.RequestCtx) string {
+	name, _ := ctx.UserValue(accountUserValue).(string)
+	return name
+}
+
+// signHandler hands out signed, expiring links to /album/ for the calling account.
+// It takes the same query parameters as /album/ plus an optional ttl duration, which
+// must be positive and no longer than the configured maximum.
+func signHandler(ctx *fasthttp.RequestCtx, params fasthttprouter.Params) {
+	if auth == nil {
+		writeJSONError(ctx, fasthttp.StatusNotFound, errors.New("link signing is disabled"))
+		return
+	}
+
+	ttl := 24 * time.Hour
+	if auth.maxTTL > 0 && ttl > auth.maxTTL {
+		ttl = auth.maxTTL
+	}
+	if raw := ctx.QueryArgs().Peek("ttl"); len(raw) > 0 {
+		parsed, err := time.ParseDuration(string(raw))
+		if err != nil || parsed <= 0 {
+			writeJSONError(ctx, fasthttp.StatusBadRequest, errInvalidTTL)
+			return
+		}
+		ttl = parsed
+	}
+	if auth.maxTTL > 0 && ttl > auth.maxTTL {
+		writeJSONError(ctx, fasthttp.StatusBadRequest, fmt.Errorf("ttl is longer than the maximum of %s", auth.maxTTL))
+		return
+	}
+
+	args := &fasthttp.Args{}
+	ctx.QueryArgs().CopyTo(args)
+	args.Del("ttl")
+
+	expires := time.Now().Add(ttl)
+	query := auth.SignLink("/album/", args, requestAccount(ctx), expires)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(map[string]interface{}{
+		"url":     "/album/?" + query,
+		"expires": expires.UTC(),
+	})
+}
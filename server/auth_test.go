@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func parseArgs(query string) *fasthttp.Args {
+	args := &fasthttp.Args{}
+	args.Parse(query)
+	return args
+}
+
+func TestCanonicalQueryEscapes(t *testing.T) {
+	// Unescaped, both queries read a=1&b=2&expires=9.
+	collisions := [][2]string{
+		{"a=1%26b%3D2&expires=9", "a=1&b=2&expires=9"},
+		{"a%3D1=x&expires=9", "a=1%3Dx&expires=9"},
+	}
+	a := &authenticator{secret: []byte("secret")}
+	for _, pair := range collisions {
+		first, second := canonicalQuery(parseArgs(pair[0])), canonicalQuery(parseArgs(pair[1]))
+		if first == second {
+			t.Errorf("%q and %q share the canonical query %q", pair[0], pair[1], first)
+		}
+		if a.sign("/album/", first) == a.sign("/album/", second) {
+			t.Errorf("%q and %q share a signature", pair[0], pair[1])
+		}
+	}
+}
+
+func TestCanonicalQueryIsStable(t *testing.T) {
+	got := canonicalQuery(parseArgs("url=http%3A%2F%2Fmp3.zing.vn%2Falbum%2Fx.html&sig=abc&account=me&expires=9"))
+	want := "account=me&expires=9&url=http%3A%2F%2Fmp3.zing.vn%2Falbum%2Fx.html"
+	if got != want {
+		t.Errorf("canonicalQuery = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// fasthttp cannot tell a handler that its client has gone away, as nothing reads from
+// the connection while the handler runs. requestContext fills that gap the way net/http
+// does: it reads from the connection in the background, and a failed read means the
+// client closed it.
+
+// watchListener wraps the connections it accepts so requestContext can watch them.
+type watchListener struct {
+	net.Listener
+}
+
+func (l watchListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	c := &watchedConn{Conn: conn}
+	watchedConns.add(c)
+	return c, nil
+}
+
+// connRegistry finds the watchedConn of a request by its remote address.
+type connRegistry struct {
+	mu    sync.Mutex
+	conns map[string]*watchedConn
+}
+
+var watchedConns = &connRegistry{conns: make(map[string]*watchedConn)}
+
+func (r *connRegistry) add(c *watchedConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.conns[c.RemoteAddr().String()] = c
+}
+
+func (r *connRegistry) remove(c *watchedConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conns[c.RemoteAddr().String()] == c {
+		delete(r.conns, c.RemoteAddr().String())
+	}
+}
+
+func (r *connRegistry) lookup(addr net.Addr) *watchedConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conns[addr.String()]
+}
+
+// watchedConn is a connection whose reads may be taken over by a watch. Whatever the
+// watch reads is handed back to the server's next Read.
+type watchedConn struct {
+	net.Conn
+
+	mu       sync.Mutex
+	pending  []byte
+	err      error         // the error of a watch's read, returned once pending is drained
+	watching chan struct{} // closed when the running watch has stopped
+}
+
+func (c *watchedConn) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	watching := c.watching
+	c.mu.Unlock()
+	if watching != nil {
+		<-watching
+	}
+
+	c.mu.Lock()
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		c.mu.Unlock()
+		return n, nil
+	}
+	err := c.err
+	c.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
+
+func (c *watchedConn) Close() error {
+	watchedConns.remove(c)
+	return c.Conn.Close()
+}
+
+// watch returns a context which is cancelled with parent or when the client closes the
+// connection. stop must be called before the handler returns, so the server can read
+// the next request.
+func (c *watchedConn) watch(parent context.Context) (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(parent)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		cancel()
+		return ctx, cancel
+	}
+	if len(c.pending) > 0 || c.watching != nil {
+		// The client already sent its next request, so it is still there.
+		return ctx, cancel
+	}
+
+	done := make(chan struct{})
+	c.watching = done
+	go func() {
+		defer close(done)
+		b := make([]byte, 1)
+		n, err := c.Conn.Read(b)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.pending = append(c.pending, b[:n]...)
+		if netErr, ok := err.(net.Error); err != nil && !(ok && netErr.Timeout()) {
+			c.err = err
+			cancel()
+		}
+	}()
+
+	return ctx, func() {
+		// Interrupt the read; the server sets no read deadlines of its own to restore.
+		c.Conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+		c.Conn.SetReadDeadline(time.Time{})
+
+		c.mu.Lock()
+		c.watching = nil
+		c.mu.Unlock()
+		cancel()
+	}
+}
+
+// requestContext returns a context for the work of a request, cancelled when its client
+// disconnects or shutdown cancels jobs. stop must be called before the handler returns.
+func requestContext(ctx *fasthttp.RequestCtx) (context.Context, func()) {
+	if c := watchedConns.lookup(ctx.RemoteAddr()); c != nil {
+		return c.watch(jobsContext)
+	}
+	return context.WithCancel(jobsContext)
+}
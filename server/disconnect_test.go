@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func serveWatched(t *testing.T, handler fasthttp.RequestHandler) (string, func()) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fasthttp.Server{Handler: handler}
+	go server.Serve(watchListener{ln})
+	return ln.Addr().String(), func() { ln.Close() }
+}
+
+func TestRequestContextCancelledOnDisconnect(t *testing.T) {
+	cancelled := make(chan bool, 1)
+	addr, stop := serveWatched(t, func(ctx *fasthttp.RequestCtx) {
+		reqCtx, done := requestContext(ctx)
+		defer done()
+		select {
+		case <-reqCtx.Done():
+			cancelled <- true
+		case <-time.After(2 * time.Second):
+			cancelled <- false
+		}
+	})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: test\r\n\r\n"))
+	time.Sleep(50 * time.Millisecond)
+	conn.Close()
+
+	if !<-cancelled {
+		t.Error("the request context was not cancelled when the client disconnected")
+	}
+}
+
+func TestRequestContextKeepsPipelinedRequests(t *testing.T) {
+	addr, stop := serveWatched(t, func(ctx *fasthttp.RequestCtx) {
+		reqCtx, done := requestContext(ctx)
+		select {
+		case <-reqCtx.Done():
+			t.Error("the request context was cancelled while the client was connected")
+		case <-time.After(50 * time.Millisecond):
+		}
+		done()
+		ctx.SetBodyString(string(ctx.Path()))
+	})
+	defer stop()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The second request arrives while the first is handled, so the watch reads into it.
+	conn.Write([]byte("GET /first HTTP/1.1\r\nHost: test\r\n\r\nGET /second HTTP/1.1\r\nHost: test\r\n\r\n"))
+
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"/first", "/second"} {
+		var resp fasthttp.Response
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if err := resp.Read(r); err != nil {
+			t.Fatalf("reading the response to %s: %v", want, err)
+		}
+		if string(resp.Body()) != want {
+			t.Errorf("response body = %q, want %q", resp.Body(), want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/buaazp/fasthttprouter"
+	"github.com/valyala/fasthttp"
+)
+
+// Job states reported by /api/jobs.
+const (
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobCancelled = "cancelled"
+)
+
+var (
+	validJobID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+	errDuplicateJob = errors.New("a job with this id already exists")
+)
+
+// jobRecord is the progress of a single album job as shown in the UI.
+type jobRecord struct {
+	ID       string     `json:"id"`
+	URL      string     `json:"url"`
+	Format   string     `json:"format"`
+	Items    string     `json:"items,omitempty"`
+	State    string     `json:"state"`
+	Total    int        `json:"total"`
+	Done     int        `json:"done"`
+	Failed   int        `json:"failed"`
+	Bytes    int64      `json:"bytes"`
+	Attempts int        `json:"attempts"`
+	Started  time.Time  `json:"started"`
+	Finished *time.Time `json:"finished,omitempty"`
+	// Link re-runs the same download.
+	Link string `json:"link"`
+
+	account  string
+	registry *jobRegistry
+}
+
+// ItemDone records a finished item of size bytes which took the given number of upstream attempts.
+func (r *jobRecord) ItemDone(bytes int64, attempts int) {
+	r.registry.mu.Lock()
+	defer r.registry.mu.Unlock()
+	r.Done++
+	r.Bytes += bytes
+	r.Attempts += attempts
+}
+
+// ItemFailed records an item which could not be fetched.
+func (r *jobRecord) ItemFailed(attempts int) {
+	r.registry.mu.Lock()
+	defer r.registry.mu.Unlock()
+	r.Failed++
+	r.Attempts += attempts
+}
+
+// Finish marks the job as complete, or cancelled if err is non-nil.
+func (r *jobRecord) Finish(err error) {
+	r.registry.mu.Lock()
+	defer r.registry.mu.Unlock()
+
+	now := time.Now()
+	r.Finished = &now
+	r.State = jobDone
+	if err != nil {
+		r.State = jobCancelled
+	}
+}
+
+// jobRegistry remembers the most recent album jobs for the job history.
+type jobRegistry struct {
+	max int
+
+	mu   sync.Mutex
+	jobs []*jobRecord // oldest first
+}
+
+var jobHistory = &jobRegistry{max: 100}
+
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Start registers a new running job. id is used when valid, otherwise a random one is
+// generated. A valid id which is already registered is refused with errDuplicateJob, so
+// every job in the history can be told apart.
+func (j *jobRegistry) Start(id, account string, record jobRecord) (*jobRecord, error) {
+	r := &record
+	r.State = jobRunning
+	r.Started = time.Now()
+	r.account = account
+	r.registry = j
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !validJobID.MatchString(id) {
+		id = newJobID()
+		for j.findLocked(id) != nil {
+			id = newJobID()
+		}
+	} else if j.findLocked(id) != nil {
+		return nil, errDuplicateJob
+	}
+	r.ID = id
+
+	j.jobs = append(j.jobs, r)
+	if len(j.jobs) > j.max {
+		j.jobs = j.jobs[len(j.jobs)-j.max:]
+	}
+	return r, nil
+}
+
+// findLocked returns the job with the given id, or nil. j.mu must be held.
+func (j *jobRegistry) findLocked(id string) *jobRecord {
+	for _, r := range j.jobs {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// List returns copies of the jobs visible to account, newest first.
+// When auth is disabled every job is visible.
+func (j *jobRegistry) List(account string) []jobRecord {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	list := []jobRecord{}
+	for i := len(j.jobs) - 1; i >= 0; i-- {
+		r := j.jobs[i]
+		if auth != nil && r.account != account {
+			continue
+		}
+		list = append(list, *r)
+	}
+	return list
+}
+
+func jobsHandler(ctx *fasthttp.RequestCtx, params fasthttprouter.Params) {
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetContentType("application/json")
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	json.NewEncoder(ctx).Encode(jobHistory.List(requestAccount(ctx)))
+}
@@ -0,0 +1,28 @@
+package server
+
+import "testing"
+
+func TestJobRegistryRejectsDuplicateIDs(t *testing.T) {
+	j := &jobRegistry{max: 10}
+
+	first, err := j.Start("abc", "me", jobRecord{URL: "first"})
+	if err != nil || first.ID != "abc" {
+		t.Fatalf("Start = %+v, %v", first, err)
+	}
+	if _, err := j.Start("abc", "someone-else", jobRecord{URL: "second"}); err != errDuplicateJob {
+		t.Errorf("Start with a registered id: error %v, want %v", err, errDuplicateJob)
+	}
+	if len(j.jobs) != 1 || j.jobs[0].URL != "first" {
+		t.Errorf("jobs %+v, want only the first", j.jobs)
+	}
+
+	// Invalid ids are replaced by unique generated ones.
+	ids := map[string]bool{"abc": true}
+	for _, id := range []string{"", "", "has space", "ünïcode"} {
+		r, err := j.Start(id, "me", jobRecord{})
+		if err != nil || !validJobID.MatchString(r.ID) || ids[r.ID] {
+			t.Errorf("Start(%q) = %q, %v; want a new valid id", id, r.ID, err)
+		}
+		ids[r.ID] = true
+	}
+}
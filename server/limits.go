@@ -0,0 +1,277 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+var (
+	errRateLimited    = errors.New("rate limit exceeded, slow down")
+	errTooManyJobs    = errors.New("too many concurrent downloads for this client")
+	errHostNotAllowed = errors.New("url host is not allowed")
+	errAlbumTooLarge  = errors.New("album exceeds the maximum allowed size")
+
+	errTooManyRedirects = errors.New("stopped after 10 redirects")
+)
+
+// limitConfig holds the abuse protection settings for the album endpoints.
+type limitConfig struct {
+	IPRate        float64 // requests per second per client IP
+	IPBurst       int
+	KeyRate       float64 // requests per second per API key
+	KeyBurst      int
+	JobsPerClient int
+	MaxItems      int
+	MaxBytes      int64
+	AllowedHosts  []string
+	TrustProxy    bool
+}
+
+// tokenBucket refills at a constant rate up to its burst size.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter keeps a token bucket per key.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow takes a token from key's bucket, reporting false if none are left.
+// A limiter with a non-positive rate allows everything.
+func (l *rateLimiter) Allow(key string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) > 10000 {
+			l.pruneLocked(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// pruneLocked forgets buckets which have refilled completely, as they behave like new ones.
+func (l *rateLimiter) pruneLocked(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// jobSlots caps the number of concurrent album jobs per client.
+type jobSlots struct {
+	max int
+
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func newJobSlots(max int) *jobSlots {
+	return &jobSlots{
+		max:     max,
+		running: make(map[string]int),
+	}
+}
+
+// Acquire reserves a job slot for client. The returned func releases it and must be called exactly once.
+func (s *jobSlots) Acquire(client string) (func(), bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.max > 0 && s.running[client] >= s.max {
+		return nil, false
+	}
+	s.running[client]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			s.running[client]--
+			if s.running[client] <= 0 {
+				delete(s.running, client)
+			}
+		})
+	}, true
+}
+
+// clientLimits enforces limitConfig across all requests.
+type clientLimits struct {
+	config   limitConfig
+	ipRate   *rateLimiter
+	keyRate  *rateLimiter
+	jobSlots *jobSlots
+}
+
+func newClientLimits(config limitConfig) *clientLimits {
+	return &clientLimits{
+		config:   config,
+		ipRate:   newRateLimiter(config.IPRate, config.IPBurst),
+		keyRate:  newRateLimiter(config.KeyRate, config.KeyBurst),
+		jobSlots: newJobSlots(config.JobsPerClient),
+	}
+}
+
+var limits = newClientLimits(limitConfig{})
+
+// requestAPIKey returns the API key a request was made with, if any.
+func requestAPIKey(ctx *fasthttp.RequestCtx) string {
+	key := ctx.Request.Header.Peek("X-API-Key")
+	if len(key) == 0 {
+		key = ctx.QueryArgs().Peek("api_key")
+	}
+	return string(key)
+}
+
+// clientIP returns the address of the client, honoring X-Forwarded-For when behind a trusted proxy.
+// Only the rightmost address is used: it was added by the proxy, while those before it come
+// from the client and can be anything.
+func (l *clientLimits) clientIP(ctx *fasthttp.RequestCtx) string {
+	if l.config.TrustProxy {
+		forwarded := strings.Split(string(ctx.Request.Header.Peek("X-Forwarded-For")), ",")
+		if ip := strings.TrimSpace(forwarded[len(forwarded)-1]); ip != "" {
+			return ip
+		}
+	}
+	return ctx.RemoteIP().String()
+}
+
+// clientID identifies the client for per-client limits: its account if authenticated, else its IP.
+// API keys are not used until checked, as made up ones would give every request a fresh client.
+func (l *clientLimits) clientID(ctx *fasthttp.RequestCtx) string {
+	if account := requestAccount(ctx); account != "" {
+		return "account:" + account
+	}
+	return "ip:" + l.clientIP(ctx)
+}
+
+// Allow applies the per-IP and per-account rate limits, writing a 429 response when exceeded.
+func (l *clientLimits) Allow(ctx *fasthttp.RequestCtx) bool {
+	ip := l.clientIP(ctx)
+	account := requestAccount(ctx)
+
+	if !l.ipRate.Allow(ip) || (account != "" && !l.keyRate.Allow(account)) {
+		log.Warn("Rate limited request",
+			"client_ip", ip,
+			"path", string(ctx.Path()),
+		)
+		ctx.Response.Header.Set("Retry-After", "1")
+		writeJSONError(ctx, fasthttp.StatusTooManyRequests, errRateLimited)
+		return false
+	}
+	return true
+}
+
+// AllowedURL reports whether rawURL is an http(s) URL whose host is in the allowlist.
+func (l *clientLimits) AllowedURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+
+	host := strings.ToLower(u.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return l.allowedHost(host)
+}
+
+// allowedHost reports whether host, without a port, is in the allowlist or a subdomain
+// of an entry. Everything is allowed when the allowlist is empty.
+func (l *clientLimits) allowedHost(host string) bool {
+	if len(l.config.AllowedHosts) == 0 {
+		return true
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, allowed := range l.config.AllowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed != "" && (host == allowed || strings.HasSuffix(host, "."+allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// upstreamClient returns an HTTP client which only connects to allowed hosts. Checking
+// in the dialer covers the URLs found upstream, such as player XML and feed URLs, and
+// every redirect hop is checked before it is followed. Proxies from the environment are
+// not used, as the dialer would only see the proxy.
+func (l *clientLimits) upstreamClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				host, _, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				if !l.allowedHost(host) {
+					return nil, errHostNotAllowed
+				}
+				return dialer.DialContext(ctx, network, addr)
+			},
+			MaxIdleConns:          100,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errTooManyRedirects
+			}
+			if !l.AllowedURL(request.URL.String()) {
+				return errHostNotAllowed
+			}
+			return nil
+		},
+	}
+}
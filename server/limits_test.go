@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamClientAllowlist(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("internal server reached for %s", r.URL)
+	}))
+	defer internal.Close()
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, internal.URL+"/secret", http.StatusFound)
+		}
+	}))
+	defer public.Close()
+
+	// The public server is allowed by name, the internal one only has its IP address.
+	u, _ := url.Parse(public.URL)
+	publicURL := "http://localhost:" + u.Port()
+	client := newClientLimits(limitConfig{AllowedHosts: []string{"localhost"}}).upstreamClient()
+
+	response, err := client.Get(publicURL + "/")
+	if err != nil {
+		t.Fatalf("allowed host: %v", err)
+	}
+	response.Body.Close()
+
+	for _, rawURL := range []string{internal.URL + "/secret", publicURL + "/redirect"} {
+		response, err := client.Get(rawURL)
+		if err == nil {
+			response.Body.Close()
+		}
+		if err == nil || !strings.Contains(err.Error(), errHostNotAllowed.Error()) {
+			t.Errorf("GET %s: error %v, want %v", rawURL, err, errHostNotAllowed)
+		}
+	}
+}
+
+func TestAllowedHost(t *testing.T) {
+	l := newClientLimits(limitConfig{AllowedHosts: []string{"zing.vn", " NixCDN.com "}})
+	cases := map[string]bool{
+		"zing.vn":             true,
+		"mp3.zing.vn":         true,
+		"ZING.VN.":            true,
+		"stream.nixcdn.com":   true,
+		"notzing.vn":          false,
+		"zing.vn.example.com": false,
+		"127.0.0.1":           false,
+		"":                    false,
+	}
+	for host, want := range cases {
+		if got := l.allowedHost(host); got != want {
+			t.Errorf("allowedHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	if !newClientLimits(limitConfig{}).allowedHost("127.0.0.1") {
+		t.Error("an empty allowlist should allow every host")
+	}
+}
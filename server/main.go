@@ -0,0 +1,716 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	_ "net/http/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Taik/zing-mp3/config"
+	_ "github.com/Taik/zing-mp3/provider/nhaccuatui"
+	"github.com/Taik/zing-mp3/zing"
+	"github.com/Taik/zing-mp3/zing/api"
+	"github.com/buaazp/fasthttprouter"
+	"github.com/oxtoacart/bpool"
+	"github.com/valyala/fasthttp"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+var (
+	albumParser = zing.DefaultParser
+	zingClient  = zing.DefaultClient
+
+	// sharedAudioCache holds downloaded tracks across jobs; nil when disabled.
+	sharedAudioCache *audioCache
+
+	// jobWorkers is the number of items each album job downloads at once,
+	// and jobBuffers the number of download buffers it keeps around.
+	jobWorkers = 8
+	jobBuffers = 12
+)
+
+type albumJob struct {
+	ctx           context.Context
+	cancel        context.CancelFunc
+	album         *zing.Album
+	downloadQueue chan zing.AlbumItem
+	downloadSync  *sync.WaitGroup
+	archiveQueue  chan archiveFile
+	archiveSync   *sync.WaitGroup
+	archive       ArchiveWriter
+
+	bufferPool *bpool.BufferPool
+	audioCache *audioCache
+	record     *jobRecord
+
+	// bytesLeft is the remaining download budget; zero or less disables the limit.
+	bytesLeft int64
+	bytesDone int64
+}
+
+type archiveFile struct {
+	Filename string
+	Buffer   *bytes.Buffer
+}
+
+func newAlbumJob(parent context.Context, album *zing.Album, record *jobRecord) (*albumJob, error) {
+	ctx, cancel := context.WithCancel(parent)
+	return &albumJob{
+		ctx:           ctx,
+		cancel:        cancel,
+		album:         album,
+		downloadQueue: make(chan zing.AlbumItem),
+		downloadSync:  &sync.WaitGroup{},
+		archiveQueue:  make(chan archiveFile, 2),
+		archiveSync:   &sync.WaitGroup{},
+		bufferPool:    bpool.NewBufferPool(jobBuffers),
+		audioCache:    sharedAudioCache,
+		bytesLeft:     limits.config.MaxBytes,
+		record:        record,
+	}, nil
+}
+
+// Run downloads every album item into archive. It stops early and returns the
+// context's error if the job is cancelled, e.g. because the client went away.
+func (a *albumJob) Run(archive ArchiveWriter) error {
+	defer a.cancel()
+	a.archive = archive
+
+	metrics.activeJobs.Add(1)
+	defer metrics.activeJobs.Add(-1)
+	metrics.queueDepth.Add(int64(len(a.album.Items)))
+
+	// Start N workers
+	a.downloadSync.Add(jobWorkers)
+	for i := 0; i < jobWorkers; i++ {
+		go a.startDownloader()
+	}
+
+	// Start Archiver
+	a.archiveSync.Add(1)
+	go a.startArchiver()
+
+	if !zingClient.SkipArtwork {
+		a.downloadSync.Add(1)
+		go a.archiveArtwork()
+	}
+
+feed:
+	for i, item := range a.album.Items {
+		select {
+		case a.downloadQueue <- item:
+		case <-a.ctx.Done():
+			metrics.queueDepth.Add(-int64(len(a.album.Items) - i))
+			break feed
+		}
+	}
+	close(a.downloadQueue)
+	a.downloadSync.Wait()
+
+	close(a.archiveQueue)
+	a.archiveSync.Wait()
+
+	return a.ctx.Err()
+}
+
+func (a *albumJob) startDownloader() {
+	defer a.downloadSync.Done()
+
+	for item := range a.downloadQueue {
+		metrics.queueDepth.Add(-1)
+		if a.ctx.Err() != nil {
+			continue
+		}
+		buf := a.getBuffer()
+
+		log.Debug("Processing album item",
+			"artist", item.Artist,
+			"title", item.Title,
+			"url", item.ItemURL,
+		)
+
+		attempts, err := a.fetchItem(&item, buf)
+		if err == errAlbumTooLarge {
+			log.Warn("Album exceeds size limit, cancelling job",
+				"max_bytes", limits.config.MaxBytes,
+			)
+			a.cancel()
+		}
+		if err != nil {
+			log.Error("Unable to download item",
+				"download_url", item.DownloadURL,
+				"error", err,
+			)
+			a.putBuffer(buf)
+			a.record.ItemFailed(len(attempts))
+			continue
+		}
+
+		size := int64(buf.Len())
+		select {
+		case a.archiveQueue <- archiveFile{
+			Filename: item.Name(),
+			Buffer:   buf,
+		}:
+		case <-a.ctx.Done():
+			a.putBuffer(buf)
+			continue
+		}
+		a.record.ItemDone(size, len(attempts))
+		log.Info("Processed album item",
+			"download_url", item.DownloadURL,
+			"filename", item.Name(),
+		)
+	}
+}
+
+// archiveArtwork adds the album's cover to the archive. Albums without one, or whose
+// cover cannot be fetched, are archived without it.
+func (a *albumJob) archiveArtwork() {
+	defer a.downloadSync.Done()
+
+	cover := a.album.CoverURL()
+	if cover == "" || !limits.AllowedURL(cover) {
+		return
+	}
+	artwork, err := zingClient.Artwork(a.ctx, cover)
+	if err != nil {
+		log.Warn("Unable to fetch album artwork",
+			"artwork_url", cover,
+			"error", err,
+		)
+		return
+	}
+
+	buf := a.getBuffer()
+	buf.Write(artwork)
+	select {
+	case a.archiveQueue <- archiveFile{
+		Filename: zing.ArtworkName,
+		Buffer:   buf,
+	}:
+	case <-a.ctx.Done():
+		a.putBuffer(buf)
+	}
+}
+
+// reserveBytes returns the most an item may download without exceeding the job's budget, or -1 if unlimited.
+func (a *albumJob) reserveBytes() int64 {
+	if limits.config.MaxBytes <= 0 {
+		return -1
+	}
+	left := atomic.LoadInt64(&a.bytesLeft)
+	if left < 0 {
+		return 0
+	}
+	return left
+}
+
+// consumeBytes charges n bytes against the job's budget.
+func (a *albumJob) consumeBytes(n int64) error {
+	atomic.AddInt64(&a.bytesDone, n)
+	if limits.config.MaxBytes <= 0 {
+		return nil
+	}
+	if atomic.AddInt64(&a.bytesLeft, -n) < 0 {
+		return errAlbumTooLarge
+	}
+	return nil
+}
+
+// BytesDone returns the number of audio bytes the job has fetched so far.
+func (a *albumJob) BytesDone() int64 {
+	return atomic.LoadInt64(&a.bytesDone)
+}
+
+func (a *albumJob) getBuffer() *bytes.Buffer {
+	metrics.buffersInUse.Add(1)
+	return a.bufferPool.Get()
+}
+
+func (a *albumJob) putBuffer(buf *bytes.Buffer) {
+	metrics.buffersInUse.Add(-1)
+	a.bufferPool.Put(buf)
+}
+
+// fetchItem fills buf with the item's audio, from the shared cache when possible,
+// and returns the upstream requests it made.
+func (a *albumJob) fetchItem(item *zing.AlbumItem, buf *bytes.Buffer) ([]zing.Attempt, error) {
+	key := ""
+	if a.audioCache != nil {
+		key = audioCacheKey(item, zing.PlayerQuality)
+	}
+	if key != "" && a.audioCache.Get(key, buf) {
+		log.Debug("Serving album item from audio cache", "key", key)
+		metrics.downloadBytes.Add(float64(buf.Len()), "cache")
+		return nil, a.consumeBytes(int64(buf.Len()))
+	}
+
+	if !limits.AllowedURL(item.DownloadURL) {
+		return nil, errHostNotAllowed
+	}
+
+	start := time.Now()
+	attempts, err := downloadURL(a.ctx, buf, item.DownloadURL, a.reserveBytes())
+	if a.ctx.Err() == nil {
+		metrics.ObserveDownload(time.Since(start), int64(buf.Len()), err)
+	}
+	if err != nil {
+		return attempts, err
+	}
+	err = a.consumeBytes(int64(buf.Len()))
+	if err != nil {
+		return attempts, err
+	}
+
+	if key != "" {
+		err = a.audioCache.Put(key, buf.Bytes())
+		if err != nil {
+			log.Warn("Unable to store album item in audio cache",
+				"key", key,
+				"error", err,
+			)
+		}
+	}
+	return attempts, nil
+}
+
+func (a *albumJob) startArchiver() {
+	defer a.archiveSync.Done()
+
+	for file := range a.archiveQueue {
+		if a.ctx.Err() != nil {
+			// Keep draining so downloaders never block on a dead archive.
+			a.putBuffer(file.Buffer)
+			continue
+		}
+
+		filename := file.Filename
+		log.Debug("Copying buffer into archive",
+			"filename", filename,
+		)
+
+		err := a.archive.WriteFile(filename, int64(file.Buffer.Len()), file.Buffer)
+		a.putBuffer(file.Buffer)
+		if err == nil {
+			err = a.archive.Flush()
+		}
+		if err != nil {
+			log.Error("Unable to copy buffer into archive, cancelling job",
+				"filename", filename,
+				"error", err,
+			)
+			a.cancel()
+		}
+	}
+
+	if a.ctx.Err() != nil {
+		log.Info("Archive cancelled", "error", a.ctx.Err())
+		return
+	}
+	err := a.archive.Close()
+	if err != nil {
+		log.Error("Unable to finalize archive", "error", err)
+		return
+	}
+	log.Debug("Archive completed")
+}
+
+// downloadURL copies the body at url into buf, failing with errAlbumTooLarge
+// after maxBytes unless maxBytes is negative. Transient failures are retried by zingClient.
+func downloadURL(ctx context.Context, buf *bytes.Buffer, url string, maxBytes int64) ([]zing.Attempt, error) {
+	log.Debug("Downloading item", "download_url", url)
+	attempts, err := zingClient.Fetch(ctx, url, func(response *http.Response) error {
+		buf.Reset()
+		if maxBytes < 0 {
+			_, err := io.Copy(buf, response.Body)
+			return err
+		}
+
+		n, err := io.Copy(buf, io.LimitReader(response.Body, maxBytes+1))
+		if err == nil && n > maxBytes {
+			err = errAlbumTooLarge
+		}
+		return err
+	})
+	if err != nil {
+		log.Error("Unable to download album item",
+			"download_url", url,
+			"attempts", len(attempts),
+			"error", err,
+		)
+	}
+	return attempts, err
+}
+
+func zingAlbumHandler(ctx *fasthttp.RequestCtx, params fasthttprouter.Params) {
+	zingURL := string(ctx.QueryArgs().Peek("url"))
+	formatName := string(ctx.QueryArgs().Peek("format"))
+	itemSpec := string(ctx.QueryArgs().Peek("items"))
+	matchSpec := string(ctx.QueryArgs().Peek("match"))
+	excludeSpec := string(ctx.QueryArgs().Peek("exclude"))
+	log.Info("Zing-mp3 album request",
+		"zing_url", zingURL,
+		"format", formatName,
+		"items", itemSpec,
+		"match", matchSpec,
+		"exclude", excludeSpec,
+	)
+
+	if !limits.Allow(ctx) {
+		return
+	}
+	if !limits.AllowedURL(zingURL) {
+		writeJSONError(ctx, fasthttp.StatusForbidden, errHostNotAllowed)
+		return
+	}
+
+	format, err := lookupArchiveFormat(formatName)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		fmt.Fprint(ctx, err)
+		return
+	}
+
+	sel, err := zing.ParseSelection(itemSpec, matchSpec, excludeSpec)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		fmt.Fprint(ctx, err)
+		return
+	}
+
+	parseCtx, stop := requestContext(ctx)
+	album, err := albumParser.Parse(parseCtx, zingURL)
+	stop()
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		fmt.Fprint(ctx, err)
+		return
+	}
+	album, err = album.Select(sel)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		fmt.Fprint(ctx, err)
+		return
+	}
+	if limits.config.MaxItems > 0 && len(album.Items) > limits.config.MaxItems {
+		writeJSONError(ctx, fasthttp.StatusForbidden, errAlbumTooLarge)
+		return
+	}
+
+	ctx.SetContentType(format.ContentType)
+	ctx.Response.Header.Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=\"album.%s\"", format.Extension),
+	)
+
+	if format.WriteLinks != nil {
+		ctx.SetStatusCode(fasthttp.StatusOK)
+		err = format.WriteLinks(ctx, album)
+		if err != nil {
+			log.Error("Unable to write album links", "error", err)
+		}
+		return
+	}
+
+	release, ok := limits.jobSlots.Acquire(limits.clientID(ctx))
+	if !ok {
+		ctx.Response.Header.Del("Content-Disposition")
+		writeJSONError(ctx, fasthttp.StatusTooManyRequests, errTooManyJobs)
+		return
+	}
+
+	account := requestAccount(ctx)
+	link := &fasthttp.Args{}
+	link.Set("url", zingURL)
+	if formatName != "" {
+		link.Set("format", formatName)
+	}
+	if itemSpec != "" {
+		link.Set("items", itemSpec)
+	}
+	if matchSpec != "" {
+		link.Set("match", matchSpec)
+	}
+	if excludeSpec != "" {
+		link.Set("exclude", excludeSpec)
+	}
+	record, err := jobHistory.Start(string(ctx.QueryArgs().Peek("job")), account, jobRecord{
+		URL:    zingURL,
+		Format: formatName,
+		Items:  itemSpec,
+		Total:  len(album.Items),
+		Link:   "/album/?" + link.String(),
+	})
+	if err != nil {
+		release()
+		ctx.Response.Header.Del("Content-Disposition")
+		writeJSONError(ctx, fasthttp.StatusConflict, err)
+		return
+	}
+	ctx.Response.Header.Set("X-Job-ID", record.ID)
+
+	job, err := newAlbumJob(jobsContext, album, record)
+	if err != nil {
+		record.Finish(err)
+		release()
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		fmt.Fprint(ctx, err)
+		return
+	}
+
+	// The archive is streamed after the handler returns; a failed write means the
+	// client has gone away, which cancels the job and its downloads.
+	inflightJobs.Add(1)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer inflightJobs.Done()
+		defer release()
+
+		err := job.Run(format.NewWriter(w))
+		record.Finish(err)
+		if account != "" {
+			auth.quotas.AddBytes(account, job.BytesDone())
+		}
+		if err != nil {
+			log.Info("Album job cancelled",
+				"zing_url", zingURL,
+				"error", err,
+			)
+		}
+	})
+}
+
+// Main runs the web server with the command line flags in args, until it is stopped by a signal.
+// Flags not given in args are read from the environment and the config file.
+func Main(args []string) error {
+	flags, run := Command()
+	flags.Parse(args)
+	if _, err := config.Apply(flags); err != nil {
+		log.Crit("Unable to load config", "error", err)
+		return err
+	}
+	return run()
+}
+
+// Command defines the server's flags on a new flag set and returns it together with
+// the function running the server once the flags have been parsed.
+func Command() (*flag.FlagSet, func() error) {
+	flags := config.NewFlagSet("serve", flag.ExitOnError)
+	var (
+		port            = flags.Int("port", 8000, "Port to listen on")
+		shutdownTimeout = flags.Duration("shutdown-timeout", 30*time.Second, "How long to wait for in-flight jobs on shutdown")
+		cacheDir        = flags.String("cache-dir", "", "Directory to cache parsed albums in (in-memory if empty)")
+		cacheSize       = flags.Int("cache-size", 256, "Number of parsed albums to keep in memory")
+		cacheTTL        = flags.Duration("cache-ttl", zing.DefaultCacheTTL, "How long parsed albums are cached")
+
+		audioCacheDir  = flags.String("audio-cache-dir", "", "Directory to cache downloaded tracks in (disabled if empty)")
+		audioCacheSize = flags.Int64("audio-cache-size", 1024, "Maximum size of the track cache in MB")
+
+		ipRate        = flags.Float64("rate-ip", 30, "Requests per minute allowed per client IP (0 disables)")
+		keyRate       = flags.Float64("rate-key", 120, "Requests per minute allowed per API key (0 disables)")
+		rateBurst     = flags.Int("rate-burst", 10, "Requests a client may make in a burst before being limited")
+		jobsPerClient = flags.Int("max-jobs-per-client", 2, "Concurrent album downloads allowed per client (0 disables)")
+		maxItems      = flags.Int("max-album-items", 200, "Maximum number of items in a downloadable album (0 disables)")
+		maxAlbumMB    = flags.Int64("max-album-size", 2048, "Maximum size of a downloaded album in MB (0 disables)")
+		allowedHosts  = flags.String("allowed-hosts", "zing.vn,zingmp3.vn,zadn.vn,zmdcdn.me,nhaccuatui.com,nixcdn.com", "Comma-separated upstream hosts (and their subdomains) the server may fetch from (any if empty)")
+		trustProxy    = flags.Bool("trust-proxy", false, "Use X-Forwarded-For to identify clients")
+
+		maxAttempts = flags.Int("max-attempts", zing.DefaultRetryPolicy.MaxAttempts, "Attempts per upstream request before giving up")
+
+		authConfig = flags.String("auth-config", "", "JSON file with API keys and the link signing secret (open access if empty)")
+		maxLinkTTL = flags.Duration("max-link-ttl", 7*24*time.Hour, "Longest validity /api/sign gives a download link")
+
+		workers   = flags.Int("workers", jobWorkers, "Concurrent item downloads per album job")
+		buffers   = flags.Int("buffers", jobBuffers, "Download buffers kept per album job")
+		pprofAddr = flags.String("pprof-addr", "localhost:6060", "Address serving pprof and expvar (disabled if empty)")
+		logLevel  = flags.String("log-level", "debug", "Minimum level logged: debug, info, warn, error or crit")
+
+		apiKey     = flags.String("api-key", "", "Zing JSON API key, used when a page cannot be scraped")
+		apiSecret  = flags.String("api-secret", "", "Zing JSON API signing secret")
+		apiVersion = flags.String("api-version", "", "Zing web player version sent with JSON API requests")
+		cookies    = flags.String("cookies", "", "cookies.txt file or Cookie header of a logged in session, for VIP tracks")
+
+		nameTemplate = flags.String("name-template", zing.DefaultNameTemplate, "Template of track filenames in archives, using {{.Artist}}, {{.Title}} and {{.ID}}")
+
+		skipArtwork = flags.Bool("skip-artwork", false, "Leave the album cover out of archives")
+		artworkSize = flags.Int("artwork-size", zing.DefaultArtworkSize, "Largest width or height of archived album covers (0 keeps them as served)")
+	)
+	return flags, func() error {
+		return serve(serveOptions{
+			port:            *port,
+			shutdownTimeout: *shutdownTimeout,
+			cacheDir:        *cacheDir,
+			cacheSize:       *cacheSize,
+			cacheTTL:        *cacheTTL,
+			audioCacheDir:   *audioCacheDir,
+			audioCacheSize:  *audioCacheSize,
+			limits: limitConfig{
+				IPRate:        *ipRate / 60,
+				IPBurst:       *rateBurst,
+				KeyRate:       *keyRate / 60,
+				KeyBurst:      *rateBurst,
+				JobsPerClient: *jobsPerClient,
+				MaxItems:      *maxItems,
+				MaxBytes:      *maxAlbumMB << 20,
+				AllowedHosts:  splitList(*allowedHosts),
+				TrustProxy:    *trustProxy,
+			},
+			maxAttempts:  *maxAttempts,
+			authConfig:   *authConfig,
+			maxLinkTTL:   *maxLinkTTL,
+			workers:      *workers,
+			buffers:      *buffers,
+			pprofAddr:    *pprofAddr,
+			logLevel:     *logLevel,
+			apiKey:       *apiKey,
+			apiSecret:    *apiSecret,
+			apiVersion:   *apiVersion,
+			cookies:      *cookies,
+			nameTemplate: *nameTemplate,
+			skipArtwork:  *skipArtwork,
+			artworkSize:  *artworkSize,
+		})
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries so that an
+// empty value gives an empty list.
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// serveOptions are the settings of the server, as read from its flags.
+type serveOptions struct {
+	port            int
+	shutdownTimeout time.Duration
+	cacheDir        string
+	cacheSize       int
+	cacheTTL        time.Duration
+	audioCacheDir   string
+	audioCacheSize  int64
+	limits          limitConfig
+	maxAttempts     int
+	authConfig      string
+	maxLinkTTL      time.Duration
+	workers         int
+	buffers         int
+	pprofAddr       string
+	logLevel        string
+	apiKey          string
+	apiSecret       string
+	apiVersion      string
+	cookies         string
+	nameTemplate    string
+	skipArtwork     bool
+	artworkSize     int
+}
+
+func serve(opts serveOptions) error {
+	level, err := log.LvlFromString(opts.logLevel)
+	if err != nil {
+		log.Crit("Invalid log level", "log_level", opts.logLevel, "error", err)
+		return err
+	}
+	zing.Logger.SetHandler(log.LvlFilterHandler(level, log.StdoutHandler))
+	log.Root().SetHandler(log.LvlFilterHandler(level, log.StdoutHandler))
+	zing.DefaultMetrics = metrics
+
+	if err := zing.SetNameTemplate(opts.nameTemplate); err != nil {
+		log.Crit("Invalid name template", "name_template", opts.nameTemplate, "error", err)
+		return err
+	}
+	limits = newClientLimits(opts.limits)
+	if opts.workers > 0 {
+		jobWorkers = opts.workers
+	}
+	if opts.buffers > 0 {
+		jobBuffers = opts.buffers
+	}
+
+	if opts.authConfig != "" {
+		auth, err = loadAuthenticator(opts.authConfig)
+		if err != nil {
+			log.Crit("Unable to load auth config", "auth_config", opts.authConfig, "error", err)
+			return err
+		}
+		auth.maxTTL = opts.maxLinkTTL
+	} else {
+		log.Warn("No -auth-config given, the service is open to everyone")
+	}
+
+	// Every upstream fetch goes through the allowlist, not just the URLs clients send.
+	upstream := limits.upstreamClient()
+	zingClient.HTTPClient = upstream
+	zingClient.Retry.MaxAttempts = opts.maxAttempts
+	zingClient.SkipArtwork = opts.skipArtwork
+	zingClient.ArtworkSize = opts.artworkSize
+	if opts.apiKey != "" && opts.apiSecret != "" {
+		zingClient.API = api.NewClient(opts.apiKey, opts.apiSecret, opts.apiVersion)
+		zingClient.API.HTTPClient.Transport = upstream.Transport
+		zingClient.API.HTTPClient.CheckRedirect = upstream.CheckRedirect
+	}
+	if opts.cookies != "" {
+		jar, err := zing.LoadSession(opts.cookies)
+		if err != nil {
+			log.Crit("Unable to load session cookies", "error", err)
+			return err
+		}
+		zingClient.UseSession(jar)
+	}
+
+	var cache zing.Cache = zing.NewMemoryCache(opts.cacheSize)
+	if opts.cacheDir != "" {
+		diskCache, err := zing.NewDiskCache(opts.cacheDir)
+		if err != nil {
+			log.Crit("Unable to open album cache", "cache_dir", opts.cacheDir, "error", err)
+			return err
+		}
+		cache = diskCache
+	}
+	albumParser = zing.NewParser(cache, opts.cacheTTL)
+
+	if opts.audioCacheDir != "" {
+		sharedAudioCache, err = newAudioCache(opts.audioCacheDir, opts.audioCacheSize<<20)
+		if err != nil {
+			log.Crit("Unable to open audio cache", "audio_cache_dir", opts.audioCacheDir, "error", err)
+			return err
+		}
+		expvar.Publish("audio_cache", expvar.Func(func() interface{} {
+			return sharedAudioCache.Stats()
+		}))
+	}
+
+	if opts.pprofAddr != "" {
+		go func() {
+			http.ListenAndServe(opts.pprofAddr, nil)
+		}()
+	}
+
+	router := fasthttprouter.New()
+	router.GET("/", uiHandler)
+	router.GET("/api/jobs", instrument("/api/jobs", requireAuth(jobsHandler)))
+	router.GET("/album/", instrument("/album/", requireAuth(chargeQuota(zingAlbumHandler))))
+	router.GET("/api/album", instrument("/api/album", requireAuth(apiAlbumHandler)))
+	router.GET("/api/sign", instrument("/api/sign", requireAuth(signHandler)))
+	router.GET("/metrics", metricsHandler)
+	err = serveUntilSignal(fmt.Sprintf(":%d", opts.port), router.Handler, opts.shutdownTimeout)
+	if err != nil {
+		log.Crit("Server stopped", "error", err)
+	}
+	return err
+}
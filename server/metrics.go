@@ -0,0 +1,246 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Taik/zing-mp3/zing"
+	"github.com/buaazp/fasthttprouter"
+	"github.com/valyala/fasthttp"
+)
+
+// metric is anything which can render itself in the Prometheus text exposition format.
+type metric interface {
+	writeTo(w io.Writer)
+}
+
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string]float64),
+	}
+}
+
+// Add increments the counter identified by labelValues, given in the order of c.labels.
+func (c *counterVec) Add(delta float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\x00")
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+func (c *counterVec) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, strings.Split(key, "\x00")), formatFloat(c.values[key]))
+	}
+}
+
+type gauge struct {
+	name, help string
+	value      int64
+}
+
+func newGauge(name, help string) *gauge {
+	return &gauge{name: name, help: help}
+}
+
+func (g *gauge) Add(delta int64) {
+	atomic.AddInt64(&g.value, delta)
+}
+
+func (g *gauge) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", g.name, g.help, g.name, g.name, atomic.LoadInt64(&g.value))
+}
+
+type histogram struct {
+	name, help string
+	buckets    []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, buckets ...float64) *histogram {
+	return &histogram{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(upper), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = fmt.Sprintf("%s=%s", name, strconv.Quote(value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// serverMetrics holds every metric exported on /metrics. It also implements zing.Metrics.
+type serverMetrics struct {
+	requests        *counterVec
+	parseDuration   *histogram
+	downloadSeconds *histogram
+	downloadBytes   *counterVec
+	downloads       *counterVec
+	upstreamErrors  *counterVec
+	activeJobs      *gauge
+	queueDepth      *gauge
+	buffersInUse    *gauge
+
+	all []metric
+}
+
+func newServerMetrics() *serverMetrics {
+	m := &serverMetrics{
+		requests: newCounterVec("zing_http_requests_total",
+			"HTTP requests served, by route and status code.", "path", "code"),
+		parseDuration: newHistogram("zing_album_parse_duration_seconds",
+			"Time spent parsing album data from Zing.", .1, .25, .5, 1, 2.5, 5, 10),
+		downloadSeconds: newHistogram("zing_item_download_duration_seconds",
+			"Time spent downloading a single album item.", .5, 1, 2.5, 5, 10, 30, 60, 120),
+		downloadBytes: newCounterVec("zing_item_download_bytes_total",
+			"Bytes of audio received, by source.", "source"),
+		downloads: newCounterVec("zing_item_downloads_total",
+			"Album item downloads, by result.", "result"),
+		upstreamErrors: newCounterVec("zing_upstream_errors_total",
+			"Failed requests to Zing or its CDN, by error type.", "type"),
+		activeJobs: newGauge("zing_active_jobs",
+			"Album jobs currently running."),
+		queueDepth: newGauge("zing_download_queue_depth",
+			"Album items waiting for a downloader across all jobs."),
+		buffersInUse: newGauge("zing_buffer_pool_in_use",
+			"Item buffers currently checked out of the job buffer pools."),
+	}
+	m.all = []metric{
+		m.requests,
+		m.parseDuration,
+		m.downloadSeconds,
+		m.downloadBytes,
+		m.downloads,
+		m.upstreamErrors,
+		m.activeJobs,
+		m.queueDepth,
+		m.buffersInUse,
+	}
+	return m
+}
+
+// ObserveParse implements zing.Metrics.
+func (m *serverMetrics) ObserveParse(duration time.Duration, err error) {
+	m.parseDuration.Observe(duration.Seconds())
+}
+
+// ObserveDownload implements zing.Metrics.
+func (m *serverMetrics) ObserveDownload(duration time.Duration, bytes int64, err error) {
+	m.downloadSeconds.Observe(duration.Seconds())
+	m.downloadBytes.Add(float64(bytes), "upstream")
+	if err != nil {
+		m.downloads.Add(1, "error")
+	} else {
+		m.downloads.Add(1, "ok")
+	}
+}
+
+// UpstreamError implements zing.Metrics.
+func (m *serverMetrics) UpstreamError(kind string) {
+	m.upstreamErrors.Add(1, kind)
+}
+
+// Render writes every metric in the Prometheus text format.
+func (m *serverMetrics) Render(w io.Writer) {
+	for _, metric := range m.all {
+		metric.writeTo(w)
+	}
+}
+
+var metrics = newServerMetrics()
+
+// instrument wraps handle so that every response is counted under path.
+func instrument(path string, handle fasthttprouter.Handle) fasthttprouter.Handle {
+	return func(ctx *fasthttp.RequestCtx, params fasthttprouter.Params) {
+		handle(ctx, params)
+		metrics.requests.Add(1, path, strconv.Itoa(ctx.Response.StatusCode()))
+	}
+}
+
+func metricsHandler(ctx *fasthttp.RequestCtx, params fasthttprouter.Params) {
+	buf := &bytes.Buffer{}
+	metrics.Render(buf)
+
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetContentType("text/plain; version=0.0.4")
+	ctx.SetBody(buf.Bytes())
+}
+
+var _ zing.Metrics = (*serverMetrics)(nil)
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	log "gopkg.in/inconshreveable/log15.v2"
+)
+
+var (
+	// jobsContext is the parent of every album job; it is cancelled when shutdown gives up waiting.
+	jobsContext, cancelJobs = context.WithCancel(context.Background())
+
+	// inflightJobs counts album jobs which are still streaming to a client.
+	inflightJobs sync.WaitGroup
+)
+
+// waitForJobs waits up to timeout for in-flight jobs to finish and reports whether they all did.
+func waitForJobs(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		inflightJobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// serveUntilSignal serves on addr until SIGINT or SIGTERM is received, then stops accepting
+// connections and drains in-flight jobs for up to drainTimeout before cancelling them.
+func serveUntilSignal(addr string, handler fasthttp.RequestHandler, drainTimeout time.Duration) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	ln = watchListener{ln}
+
+	server := &fasthttp.Server{
+		Handler: handler,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(ln)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+
+	select {
+	case err = <-serveErr:
+		return err
+	case sig := <-signals:
+		log.Info("Shutting down, draining in-flight jobs",
+			"signal", sig,
+			"timeout", drainTimeout,
+		)
+	}
+
+	ln.Close()
+	if waitForJobs(drainTimeout) {
+		log.Info("All jobs drained")
+		return nil
+	}
+
+	log.Warn("Drain timeout exceeded, cancelling in-flight jobs")
+	cancelJobs()
+	if !waitForJobs(5 * time.Second) {
+		log.Error("Jobs did not stop after cancellation")
+	}
+	return nil
+}
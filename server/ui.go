@@ -0,0 +1,268 @@
+package server
+
+import (
+	"github.com/buaazp/fasthttprouter"
+	"github.com/valyala/fasthttp"
+)
+
+// uiHandler serves the single page web UI. Everything it needs is inlined so the
+// binary has no asset files or external CDN dependencies.
+func uiHandler(ctx *fasthttp.RequestCtx, params fasthttprouter.Params) {
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetContentType("text/html; charset=utf-8")
+	ctx.SetBodyString(indexHTML)
+}
+
+const indexHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Zing MP3 downloader</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 960px; padding: 0 1em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.1em; margin-top: 2em; }
+form, .row { display: flex; gap: .5em; flex-wrap: wrap; align-items: center; }
+input[type=text], input[type=password] { flex: 1; min-width: 16em; padding: .4em; }
+button, select { padding: .4em .8em; }
+table { width: 100%; border-collapse: collapse; margin-top: 1em; }
+th, td { text-align: left; padding: .3em .5em; border-bottom: 1px solid #eee; font-size: .9em; }
+td.num { width: 3em; color: #888; }
+.muted { color: #888; font-size: .85em; }
+.error { color: #b00; }
+.bar { background: #eee; height: .6em; width: 10em; border-radius: .3em; overflow: hidden; }
+.bar div { background: #3a7; height: 100%; }
+.hidden { display: none; }
+</style>
+</head>
+<body>
+<h1>Zing MP3 downloader</h1>
+
+<div class="row">
+  <input type="password" id="apikey" placeholder="API key (if required)">
+</div>
+
+<form id="lookup">
+  <input type="text" id="url" placeholder="Paste a Zing MP3 album, playlist or song link" required>
+  <button type="submit">Preview</button>
+</form>
+<p id="status" class="muted"></p>
+
+<div id="album" class="hidden">
+  <div class="row">
+    <label><input type="checkbox" id="all" checked> Select all</label>
+    <select id="format">
+      <option value="zip">zip</option>
+      <option value="tar">tar</option>
+      <option value="tar.gz">tar.gz</option>
+      <option value="m3u">m3u (links only)</option>
+      <option value="json">json (links only)</option>
+    </select>
+    <button id="download">Download selected</button>
+  </div>
+  <table>
+    <thead><tr><th></th><th>#</th><th>Title</th><th>Artist</th><th>Filename</th></tr></thead>
+    <tbody id="items"></tbody>
+  </table>
+</div>
+
+<h2>Recent jobs</h2>
+<table>
+  <thead><tr><th>Started</th><th>Album</th><th>Format</th><th>Progress</th><th>State</th><th></th></tr></thead>
+  <tbody id="jobs"></tbody>
+</table>
+
+<script>
+(function () {
+  var $ = function (id) { return document.getElementById(id); };
+  var current = null;
+
+  $("apikey").value = localStorage.getItem("apikey") || "";
+  $("apikey").addEventListener("change", function () {
+    localStorage.setItem("apikey", $("apikey").value);
+    refreshJobs();
+  });
+
+  function headers() {
+    var key = $("apikey").value;
+    return key ? { "X-API-Key": key } : {};
+  }
+
+  // signLink swaps an /album/ link for a signed, expiring one from /api/sign, so the
+  // API key never ends up in a URL. Without auth there is nothing to sign.
+  function signLink(link) {
+    if (!$("apikey").value) { return Promise.resolve(link); }
+    return fetch("/api/sign?" + link.slice(link.indexOf("?") + 1), { headers: headers() }).then(function (resp) {
+      if (resp.status === 404) { return link; }
+      return resp.json().then(function (body) {
+        if (!resp.ok) { throw new Error(body.error || resp.statusText); }
+        return body.url;
+      });
+    });
+  }
+
+  function startDownload(link) {
+    return signLink(link).then(function (signed) {
+      var a = document.createElement("a");
+      a.href = signed;
+      a.download = "";
+      document.body.appendChild(a);
+      a.click();
+      document.body.removeChild(a);
+      setStatus("Download started.");
+      refreshJobsSoon(500);
+    }).catch(function (err) {
+      setStatus(err.message, true);
+    });
+  }
+
+  function text(tag, value) {
+    var el = document.createElement(tag);
+    el.textContent = value;
+    return el;
+  }
+
+  function setStatus(message, isError) {
+    $("status").textContent = message;
+    $("status").className = isError ? "error" : "muted";
+  }
+
+  function getJSON(url) {
+    return fetch(url, { headers: headers() }).then(function (resp) {
+      return resp.json().then(function (body) {
+        if (!resp.ok) { throw new Error(body.error || resp.statusText); }
+        return body;
+      });
+    });
+  }
+
+  $("lookup").addEventListener("submit", function (e) {
+    e.preventDefault();
+    setStatus("Loading track list...");
+    $("album").className = "hidden";
+    getJSON("/api/album?url=" + encodeURIComponent($("url").value)).then(function (album) {
+      current = album;
+      var body = $("items");
+      body.innerHTML = "";
+      album.items.forEach(function (item, i) {
+        var tr = document.createElement("tr");
+        var check = document.createElement("input");
+        check.type = "checkbox";
+        check.checked = true;
+        check.value = i + 1;
+        var td = document.createElement("td");
+        td.appendChild(check);
+        tr.appendChild(td);
+        var num = text("td", i + 1);
+        num.className = "num";
+        tr.appendChild(num);
+        tr.appendChild(text("td", item.title));
+        tr.appendChild(text("td", item.artist));
+        tr.appendChild(text("td", item.filename));
+        body.appendChild(tr);
+      });
+      $("all").checked = true;
+      $("album").className = "";
+      setStatus(album.items.length + " tracks found.");
+    }).catch(function (err) {
+      setStatus(err.message, true);
+    });
+  });
+
+  $("all").addEventListener("change", function () {
+    var checks = $("items").querySelectorAll("input[type=checkbox]");
+    for (var i = 0; i < checks.length; i++) { checks[i].checked = $("all").checked; }
+  });
+
+  $("download").addEventListener("click", function () {
+    if (!current) { return; }
+    var checks = $("items").querySelectorAll("input[type=checkbox]");
+    var picked = [];
+    for (var i = 0; i < checks.length; i++) {
+      if (checks[i].checked) { picked.push(checks[i].value); }
+    }
+    if (picked.length === 0) {
+      setStatus("Select at least one track.", true);
+      return;
+    }
+
+    var link = "/album/?url=" + encodeURIComponent(current.url) +
+      "&format=" + encodeURIComponent($("format").value) +
+      "&job=" + Math.random().toString(36).slice(2);
+    if (picked.length !== checks.length) {
+      link += "&items=" + picked.join(",");
+    }
+
+    startDownload(link);
+  });
+
+  function formatBytes(n) {
+    if (n > 1 << 20) { return (n / (1 << 20)).toFixed(1) + " MB"; }
+    return Math.round(n / 1024) + " KB";
+  }
+
+  // The job list is polled quickly only while a job is running; otherwise it is
+  // refreshed after downloads start and now and then, as every poll is a request.
+  var refreshTimer = null;
+
+  function refreshJobsSoon(delay) {
+    clearTimeout(refreshTimer);
+    refreshTimer = setTimeout(refreshJobs, delay);
+  }
+
+  function refreshJobs() {
+    if (document.hidden) {
+      refreshJobsSoon(60000);
+      return;
+    }
+    getJSON("/api/jobs").then(function (jobs) {
+      var body = $("jobs");
+      body.innerHTML = "";
+      jobs.forEach(function (job) {
+        var tr = document.createElement("tr");
+        tr.appendChild(text("td", new Date(job.started).toLocaleString()));
+        tr.appendChild(text("td", job.url));
+        tr.appendChild(text("td", job.format || "zip"));
+
+        var progress = document.createElement("td");
+        var bar = document.createElement("div");
+        bar.className = "bar";
+        var fill = document.createElement("div");
+        var finished = job.done + job.failed;
+        fill.style.width = (job.total ? 100 * finished / job.total : 0) + "%";
+        bar.appendChild(fill);
+        progress.appendChild(bar);
+        var detail = job.done + "/" + job.total + " tracks, " + formatBytes(job.bytes);
+        if (job.failed) { detail += ", " + job.failed + " failed"; }
+        progress.appendChild(text("div", detail)).className = "muted";
+        tr.appendChild(progress);
+
+        tr.appendChild(text("td", job.state));
+        var again = document.createElement("td");
+        var a = text("a", "Download again");
+        a.href = "#";
+        a.addEventListener("click", function (e) {
+          e.preventDefault();
+          startDownload(job.link);
+        });
+        again.appendChild(a);
+        tr.appendChild(again);
+        body.appendChild(tr);
+      });
+      var running = jobs.some(function (job) { return job.state === "running"; });
+      refreshJobsSoon(running ? 3000 : 60000);
+    }).catch(function () {
+      refreshJobsSoon(60000);
+    });
+  }
+
+  document.addEventListener("visibilitychange", function () {
+    if (!document.hidden) { refreshJobs(); }
+  });
+  refreshJobs();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,319 @@
+package tags
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikkyang/id3-go/encodedbytes"
+	"github.com/mikkyang/id3-go/v1"
+	"github.com/mikkyang/id3-go/v2"
+)
+
+// ErrNoTags is returned by Read for files without ID3 tags.
+var ErrNoTags = errors.New("no ID3 tags")
+
+// Comment is a comment (COMM) or unsynchronised lyrics (USLT) frame.
+type Comment struct {
+	Language    string
+	Description string
+	Text        string
+}
+
+// Picture is an attached picture (APIC) frame.
+type Picture struct {
+	// MIMEType is e.g. image/jpeg. ID3v2.2 tags only name the format, so theirs is
+	// derived from it.
+	MIMEType string
+	// Type is the ID3v2 picture type, 3 being the front cover.
+	Type        byte
+	Description string
+	Data        []byte
+}
+
+// genreRef matches the ID3v1 genre references of ID3v2 content types, e.g. (13).
+var genreRef = regexp.MustCompile(`^\((\d+)\)`)
+
+// Read returns everything in the ID3 tags of the file at path. Fields missing from
+// its ID3v2 tag are taken from its ID3v1 tag, if it has both.
+func Read(path string) (*Metadata, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	meta := &Metadata{}
+	tag2, err := parseV2(fd)
+	if err != nil {
+		return nil, err
+	}
+	if tag2 != nil {
+		readV2(meta, tag2)
+	}
+	tag1, err := parseV1(fd)
+	if err != nil {
+		return nil, err
+	}
+	if tag1 != nil {
+		readV1(meta, tag1)
+	}
+	if tag2 == nil && tag1 == nil {
+		return nil, ErrNoTags
+	}
+	return meta, nil
+}
+
+// parseV2 returns the ID3v2 tag of fd, or nil if it has none. id3-go panics on
+// malformed frames, so a panic is returned as an error.
+func parseV2(fd *os.File) (tag *v2.Tag, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			tag, err = nil, fmt.Errorf("corrupt ID3v2 tag: %v", r)
+		}
+	}()
+	return v2.ParseTag(fd), nil
+}
+
+// parseV1 returns the ID3v1 tag of fd, or nil if it has none.
+func parseV1(fd *os.File) (tag *v1.Tag, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			tag, err = nil, fmt.Errorf("corrupt ID3v1 tag: %v", r)
+		}
+	}()
+	return v1.ParseTag(fd), nil
+}
+
+func readV2(meta *Metadata, tag *v2.Tag) {
+	meta.Version = tag.Version()
+	meta.Frames = make(map[string]string)
+	meta.UserText = make(map[string]string)
+
+	// Frames are kept in a map, so visit them by ID to make the result stable.
+	ids := []string{}
+	for _, frame := range tag.AllFrames() {
+		if !contains(ids, frame.Id()) {
+			ids = append(ids, frame.Id())
+		}
+	}
+	sort.Strings(ids)
+	frames := []v2.Framer{}
+	for _, id := range ids {
+		frames = append(frames, tag.Frames(id)...)
+	}
+
+	for _, frame := range frames {
+		id := frame.Id()
+		switch f := frame.(type) {
+		case *v2.UnsynchTextFrame:
+			comment := Comment{
+				Language:    trimText(f.Language()),
+				Description: trimText(f.Description()),
+				Text:        trimText(f.Text()),
+			}
+			if id == "USLT" {
+				meta.Lyrics = append(meta.Lyrics, comment)
+			} else {
+				meta.Comments = append(meta.Comments, comment)
+			}
+		case *v2.DescTextFrame:
+			meta.UserText[trimText(f.Description())] = trimText(f.Text())
+		case *v2.TextFrame:
+			if !strings.HasPrefix(id, "T") {
+				continue
+			}
+			if text, ok := meta.Frames[id]; ok {
+				meta.Frames[id] = text + "/" + trimText(f.Text())
+			} else {
+				meta.Frames[id] = trimText(f.Text())
+			}
+		case *v2.ImageFrame:
+			meta.Pictures = append(meta.Pictures, imagePicture(f))
+		case *v2.DataFrame:
+			// id3-go leaves ID3v2.2 pictures and lyrics unparsed.
+			switch id {
+			case "PIC":
+				if picture, ok := parsePicture(f.Data()); ok {
+					meta.Pictures = append(meta.Pictures, picture)
+				}
+			case "ULT":
+				if lyrics, ok := parseLyrics(f.Data()); ok {
+					meta.Lyrics = append(meta.Lyrics, lyrics)
+				}
+			}
+		}
+	}
+
+	fields := frameIDs(meta.Version)
+	meta.Artist = meta.Frames[fields.artist]
+	meta.Title = meta.Frames[fields.title]
+	meta.Album = meta.Frames[fields.album]
+	meta.Genre = genreName(meta.Frames[fields.genre])
+	meta.Composer = meta.Frames[fields.composer]
+	meta.Year = meta.Frames[fields.year]
+	if meta.Year == "" && len(meta.Frames["TDRC"]) >= 4 {
+		meta.Year = meta.Frames["TDRC"][:4]
+	}
+	if ms, err := strconv.ParseInt(meta.Frames[fields.length], 10, 64); err == nil {
+		meta.Duration = time.Duration(ms) * time.Millisecond
+	}
+
+	for _, picture := range meta.Pictures {
+		if meta.Artwork == nil || picture.Type == frontCover {
+			meta.Artwork = picture.Data
+		}
+		if picture.Type == frontCover {
+			break
+		}
+	}
+}
+
+func readV1(meta *Metadata, tag *v1.Tag) {
+	meta.V1 = true
+	if meta.Version == "" {
+		meta.Version = tag.Version()
+	}
+	fill := func(field *string, value string) {
+		if *field == "" {
+			*field = trimText(value)
+		}
+	}
+	fill(&meta.Artist, tag.Artist())
+	fill(&meta.Title, tag.Title())
+	fill(&meta.Album, tag.Album())
+	fill(&meta.Year, tag.Year())
+	fill(&meta.Genre, tag.Genre())
+	if len(meta.Comments) == 0 {
+		for _, text := range tag.Comments() {
+			if text = trimText(text); text != "" {
+				meta.Comments = append(meta.Comments, Comment{Text: text})
+			}
+		}
+	}
+}
+
+// v2FrameIDs names the frames holding Metadata's fields in one ID3v2 version.
+type v2FrameIDs struct {
+	artist, title, album, genre, year, composer, length string
+}
+
+func frameIDs(version string) v2FrameIDs {
+	if strings.HasPrefix(version, "2.2") {
+		return v2FrameIDs{"TP1", "TT2", "TAL", "TCO", "TYE", "TCM", "TLE"}
+	}
+	return v2FrameIDs{"TPE1", "TIT2", "TALB", "TCON", "TYER", "TCOM", "TLEN"}
+}
+
+// genreName replaces an ID3v1 genre reference such as (13) with the genre's name.
+func genreName(genre string) string {
+	m := genreRef.FindStringSubmatch(genre)
+	if m == nil {
+		return genre
+	}
+	rest := strings.TrimSpace(genre[len(m[0]):])
+	if rest != "" {
+		return rest
+	}
+	if n, err := strconv.Atoi(m[1]); err == nil && n < len(v1.Genres) {
+		return v1.Genres[n]
+	}
+	return genre
+}
+
+// imagePicture converts a parsed APIC frame. id3-go has no accessors for the picture
+// type and description, and its Bytes drops the string terminators, so the type is
+// found right after the MIME type there and the description taken from String.
+func imagePicture(f *v2.ImageFrame) Picture {
+	picture := Picture{
+		MIMEType: trimText(f.MIMEType()),
+		Data:     f.Data(),
+	}
+	payload := f.Bytes()
+	if n := 1 + len(f.MIMEType()); n < len(payload) {
+		picture.Type = payload[n]
+	}
+	if parts := strings.SplitN(f.String(), "\t", 2); len(parts) == 2 {
+		picture.Description = trimText(strings.TrimSuffix(parts[1], ": <binary data>"))
+	}
+	return picture
+}
+
+// parsePicture reads the payload of an ID3v2.2 PIC frame.
+func parsePicture(payload []byte) (picture Picture, ok bool) {
+	// encodedbytes panics on strings missing their terminator.
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	rd := encodedbytes.NewReader(payload)
+	encoding, err := rd.ReadByte()
+	if err != nil || int(encoding) >= len(encodedbytes.EncodingMap) {
+		return picture, false
+	}
+	format, err := rd.ReadNumBytesString(3)
+	if err != nil {
+		return picture, false
+	}
+	picture.MIMEType = "image/" + strings.ToLower(format)
+	if picture.MIMEType == "image/jpg" {
+		picture.MIMEType = "image/jpeg"
+	}
+	if picture.Type, err = rd.ReadByte(); err != nil {
+		return picture, false
+	}
+	if picture.Description, err = rd.ReadNullTermString(encoding); err != nil {
+		return picture, false
+	}
+	if picture.Data, err = rd.ReadRest(); err != nil {
+		return picture, false
+	}
+	return picture, true
+}
+
+// parseLyrics reads the payload of an ID3v2.2 ULT frame.
+func parseLyrics(payload []byte) (lyrics Comment, ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	rd := encodedbytes.NewReader(payload)
+	encoding, err := rd.ReadByte()
+	if err != nil || int(encoding) >= len(encodedbytes.EncodingMap) {
+		return lyrics, false
+	}
+	if lyrics.Language, err = rd.ReadNumBytesString(3); err != nil {
+		return lyrics, false
+	}
+	if lyrics.Description, err = rd.ReadNullTermString(encoding); err != nil {
+		return lyrics, false
+	}
+	if lyrics.Text, err = rd.ReadRestString(encoding); err != nil {
+		return lyrics, false
+	}
+	lyrics.Text = trimText(lyrics.Text)
+	return lyrics, true
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// trimText drops the padding and terminators ID3 strings are often stored with.
+func trimText(text string) string {
+	return strings.TrimSpace(strings.TrimRight(text, "\x00"))
+}
@@ -1,25 +1,309 @@
 package tags
 
 import (
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mikkyang/id3-go"
+	"github.com/mikkyang/id3-go/encodedbytes"
+	"github.com/mikkyang/id3-go/v1"
+	"github.com/mikkyang/id3-go/v2"
 )
 
+// Metadata is what gets written into a file's ID3 tags. Empty fields clear the
+// corresponding frame.
+//
+// Read also fills in the fields after Artwork, which WriteMP3Tags ignores.
+type Metadata struct {
+	Artist   string
+	Title    string
+	Album    string
+	Genre    string
+	Year     string
+	Composer string
+	Duration time.Duration
+	// Artwork is a JPEG embedded as the front cover.
+	Artwork []byte
+
+	// Version is the ID3 version of the tag read, e.g. 2.3.0, or 1.0 for files with
+	// an ID3v1 tag only.
+	Version string
+	// V1 reports whether the file has an ID3v1 tag, alone or next to an ID3v2 one.
+	V1 bool
+	// Frames holds the text of every text frame by ID, e.g. TRCK or TPE2, including
+	// those of the fields above. Repeated frames are joined with a slash.
+	Frames map[string]string
+	// UserText holds the user defined text (TXXX) frames by description.
+	UserText map[string]string
+	Comments []Comment
+	Lyrics   []Comment
+	Pictures []Picture
+}
+
 // UpdateMP3Tags updates the os.File with the MP3 data (artist and title).
 func UpdateMP3Tags(fd *os.File, artist, title string) error {
-	mp3, err := id3.Open(fd.Name())
+	return WriteMP3Tags(fd, Metadata{Artist: artist, Title: title})
+}
+
+// V1Transliteration converts text for the ID3v1 tag WriteMP3Tags writes next to the
+// ID3v2 one, for car stereos and other devices which only show single byte text. Nil
+// leaves ID3v1 tags alone.
+var V1Transliteration = ASCII
+
+// WriteMP3Tags replaces the ID3 tags of the os.File with meta. Text is normalized to
+// NFC and written as UTF-16 with a byte order mark, and a transliterated ID3v1 tag is
+// added, see V1Transliteration. The file is left unchanged if any text cannot be
+// encoded.
+//
+// Files with an ID3v1 tag only keep it, as id3-go cannot add an ID3v2 tag to them.
+// An ID3v2.4 tag, which id3-go cannot rewrite, is replaced by an ID3v2.3 one holding
+// meta only.
+func WriteMP3Tags(fd *os.File, meta Metadata) error {
+	if err := writeV2(fd.Name(), meta); err != nil {
+		return err
+	}
+	if V1Transliteration == nil {
+		return nil
+	}
+	return writeV1(fd.Name(), meta, V1Transliteration)
+}
+
+// writeV2 replaces the ID3v2 frames of the file at path, adding a tag to untagged
+// files. The tag is saved here rather than by id3-go's File.Close, which misplaces
+// the audio when the tag grows past its padding.
+func writeV2(path string, meta Metadata) error {
+	fd, err := os.OpenFile(path, os.O_RDWR, 0)
 	if err != nil {
 		return err
 	}
-	defer mp3.Close()
+	defer fd.Close()
+
+	// The audio starts right after the tag read, or at the start of untagged files.
+	audio, err := v24Size(fd)
+	if err != nil {
+		return err
+	}
+	replaced := audio > 0
+	var tag *v2.Tag
+	if !replaced {
+		if tag, err = parseV2(fd); err != nil {
+			return err
+		}
+	}
+	switch {
+	case replaced:
+		tag = v2.NewTag(id3.LatestVersion)
+	case tag != nil:
+		audio = int64(v2.HeaderSize + tag.Size())
+	case v1.ParseTag(fd) != nil:
+		return nil
+	default:
+		tag = v2.NewTag(id3.LatestVersion)
+	}
 
 	// TODO: Add lyric frames
-	mp3.SetArtist(artist)
-	mp3.SetTitle(title)
-	mp3.SetAlbum("")
-	mp3.SetGenre("")
-	mp3.SetYear("")
+	duration := ""
+	if meta.Duration > 0 {
+		duration = strconv.FormatInt(int64(meta.Duration/time.Millisecond), 10)
+	}
+	fields := []struct{ id23, id22, text string }{
+		{"TPE1", "TP1", meta.Artist},
+		{"TIT2", "TT2", meta.Title},
+		{"TALB", "TAL", meta.Album},
+		{"TCON", "TCO", meta.Genre},
+		{"TYER", "TYE", meta.Year},
+		{"TCOM", "TCM", meta.Composer},
+		{"TLEN", "TLE", duration},
+	}
+
+	// Build every frame before touching the tag, so nothing is saved when one fails.
+	frames := make([]textFrame, len(fields))
+	for i, field := range fields {
+		frames[i], err = newTextFrame(tag, field.id23, field.id22, field.text)
+		if err != nil {
+			return err
+		}
+	}
+	for _, frame := range frames {
+		tag.DeleteFrames(frame.id)
+		if frame.frame != nil {
+			tag.AddFrames(frame.frame)
+		}
+	}
+	setFrontCover(tag, meta.Artwork)
+	if !tag.Dirty() && !replaced {
+		return nil
+	}
+
+	data := tag.Bytes()
+	if replaced && int64(len(data)) < audio {
+		// Pad the new tag to the size of the one it replaces, so the audio stays put.
+		data = append(data, make([]byte, audio-int64(len(data)))...)
+		copy(data[6:v2.HeaderSize], encodedbytes.SynchBytes(uint32(len(data)-v2.HeaderSize)))
+	}
+	if grown := int64(len(data)) - audio; grown > 0 {
+		if err := shiftBack(fd, audio, grown); err != nil {
+			return err
+		}
+	}
+	_, err = fd.WriteAt(data, 0)
+	return err
+}
 
+// v24Size returns the size of the ID3v2.4 tag at the start of fd, its footer included,
+// or 0 if there is none.
+func v24Size(fd *os.File) (int64, error) {
+	header := make([]byte, v2.HeaderSize)
+	if _, err := fd.ReadAt(header, 0); err == io.EOF {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if string(header[:3]) != "ID3" || header[3] != 4 {
+		return 0, nil
+	}
+	size, err := encodedbytes.SynchInt(header[6:])
+	if err != nil {
+		return 0, err
+	}
+	n := int64(v2.HeaderSize) + int64(size)
+	if header[5]&0x10 != 0 {
+		n += v2.HeaderSize
+	}
+	return n, nil
+}
+
+// shiftBack moves everything in fd from offset start on n bytes further, making
+// room for a larger tag. It copies from the end so nothing is overwritten unread.
+func shiftBack(fd *os.File, start, n int64) error {
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 64*1024)
+	for end := info.Size(); end > start; {
+		size := int64(len(buf))
+		if end-start < size {
+			size = end - start
+		}
+		end -= size
+		if _, err := fd.ReadAt(buf[:size], end); err != nil {
+			return err
+		}
+		if _, err := fd.WriteAt(buf[:size], end+n); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// textFrame is a text frame replacing the frames with its ID; a nil frame only
+// removes them.
+type textFrame struct {
+	id    string
+	frame *v2.TextFrame
+}
+
+// newTextFrame returns the text frame with the given ID3v2.3 or ID3v2.2 ID.
+func newTextFrame(tag id3.Tagger, id23, id22, text string) (textFrame, error) {
+	ft := v2.V23FrameTypeMap[id23]
+	if strings.HasPrefix(tag.Version(), "2.2") {
+		ft = v2.V22FrameTypeMap[id22]
+	}
+	frame := textFrame{id: ft.Id()}
+
+	text = VietnameseNFC(strings.TrimSpace(text))
+	if text == "" {
+		return frame, nil
+	}
+
+	// UTF-8 is only allowed from ID3v2.4 on; older tags are read as Latin-1 unless
+	// they are UTF-16. The frame starts out empty since id3-go sizes it by
+	// re-encoding its text, which fails for text Latin-1 cannot hold.
+	frame.frame = v2.NewTextFrame(ft, "")
+	if err := frame.frame.SetEncoding("UTF-16"); err != nil {
+		return frame, err
+	}
+	if err := frame.frame.SetText(text); err != nil {
+		return frame, err
+	}
+	return frame, nil
+}
+
+// setFrontCover replaces the attached pictures with the JPEG artwork, as an APIC
+// frame or, in ID3v2.2, a PIC frame.
+func setFrontCover(tag id3.Tagger, artwork []byte) {
+	if !strings.HasPrefix(tag.Version(), "2.") {
+		return
+	}
+
+	// id3-go cannot build picture frames, so their payload is laid out here: text
+	// encoding, MIME type (an image format in ID3v2.2), picture type and description.
+	ft, format := v2.V23FrameTypeMap["APIC"], "image/jpeg\x00"
+	if strings.HasPrefix(tag.Version(), "2.2") {
+		ft, format = v2.V22FrameTypeMap["PIC"], "JPG"
+	}
+	tag.DeleteFrames(ft.Id())
+	if len(artwork) == 0 {
+		return
+	}
+
+	payload := make([]byte, 0, len(format)+len(artwork)+3)
+	payload = append(payload, 0x00)
+	payload = append(payload, format...)
+	payload = append(payload, frontCover, 0x00)
+	payload = append(payload, artwork...)
+	tag.AddFrames(v2.NewDataFrame(ft, payload))
+}
+
+// frontCover is the ID3v2 picture type of a front cover.
+const frontCover = 0x03
+
+// writeV1 replaces the ID3v1 tag at the end of the file at path, or appends one.
+func writeV1(path string, meta Metadata, transliterate func(string) string) error {
+	fd, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	existing := make([]byte, 3)
+	offset, err := fd.Seek(-v1.TagSize, io.SeekEnd)
+	if err == nil {
+		_, err = io.ReadFull(fd, existing)
+	}
+	if err != nil || string(existing) != "TAG" {
+		if offset, err = fd.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+
+	// Fields are fixed size and NUL padded; longer text is cut off.
+	field := func(b []byte, text string) {
+		copy(b, transliterate(VietnameseNFC(strings.TrimSpace(text))))
+	}
+	tag := make([]byte, v1.TagSize)
+	copy(tag, "TAG")
+	field(tag[3:33], meta.Title)
+	field(tag[33:63], meta.Artist)
+	field(tag[63:93], meta.Album)
+	field(tag[93:97], meta.Year)
+	tag[127] = v1Genre(meta.Genre)
+
+	_, err = fd.WriteAt(tag, offset)
+	return err
+}
+
+// v1Genre returns the ID3v1 genre number of genre, or 255 for genres it lacks.
+func v1Genre(genre string) byte {
+	for i, name := range v1.Genres {
+		if i < 255 && strings.EqualFold(name, strings.TrimSpace(genre)) {
+			return byte(i)
+		}
+	}
+	return 255
+}
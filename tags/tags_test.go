@@ -0,0 +1,247 @@
+package tags
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// vietnameseFixtures spell the same titles precomposed (NFC) and decomposed (NFD).
+var vietnameseFixtures = []struct {
+	nfc, nfd, ascii, viqr string
+}{
+	{"Sơn Tùng M-TP", "Sơn Tùng M-TP", "Son Tung M-TP", "So+n Tu`ng M-TP"},
+	{"Lạc Trôi", "Lạc Trôi", "Lac Troi", "La.c Tro^i"},
+	{"Đường Một Chiều", "Đường Một Chiều", "Duong Mot Chieu", "DDu+o+`ng Mo^.t Chie^`u"},
+	{"Chạy Ngay Đi", "Chạy Ngay Đi", "Chay Ngay Di", "Cha.y Ngay DDi"},
+	{"Ước Gì", "Ước Gì", "Uoc Gi", "U+o+'c Gi`"},
+}
+
+func tempMP3(t *testing.T, content []byte) (string, func()) {
+	dir, err := ioutil.TempDir("", "tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "track.mp3")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func writeTags(t *testing.T, path string, meta Metadata) {
+	fd, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	if err := WriteMP3Tags(fd, meta); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// frameEncoding returns the text encoding byte of the first frame with id in the
+// file at path, followed by the two bytes after it.
+func frameEncoding(t *testing.T, path, id string) []byte {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := bytes.Index(data, []byte(id))
+	if i < 0 || i+13 > len(data) {
+		t.Fatalf("no %s frame in %s", id, path)
+	}
+	return data[i+10 : i+13]
+}
+
+func TestVietnameseRoundTrip(t *testing.T) {
+	defer func(transliterate func(string) string) { V1Transliteration = transliterate }(V1Transliteration)
+	V1Transliteration = ASCII
+
+	for _, fixture := range vietnameseFixtures {
+		for _, input := range []string{fixture.nfc, fixture.nfd} {
+			path, cleanup := tempMP3(t, make([]byte, 1024))
+			writeTags(t, path, Metadata{Artist: input, Title: input, Album: input})
+
+			meta, err := Read(path)
+			cleanup()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta.Title != fixture.nfc || meta.Artist != fixture.nfc || meta.Album != fixture.nfc {
+				t.Errorf("%q read back as %q / %q / %q, want %q", input, meta.Artist, meta.Title, meta.Album, fixture.nfc)
+			}
+			if !meta.V1 {
+				t.Errorf("%q: no ID3v1 tag written", input)
+			}
+		}
+	}
+}
+
+func TestTextFramesAreUTF16WithBOM(t *testing.T) {
+	path, cleanup := tempMP3(t, make([]byte, 1024))
+	defer cleanup()
+	writeTags(t, path, Metadata{Artist: vietnameseFixtures[0].nfd, Title: vietnameseFixtures[1].nfd})
+
+	for _, id := range []string{"TPE1", "TIT2"} {
+		head := frameEncoding(t, path, id)
+		if head[0] != 0x01 {
+			t.Errorf("%s encoding = %#x, want 0x01 (UTF-16)", id, head[0])
+		}
+		if bom := head[1:]; !bytes.Equal(bom, []byte{0xfe, 0xff}) && !bytes.Equal(bom, []byte{0xff, 0xfe}) {
+			t.Errorf("%s text starts with % x, want a byte order mark", id, bom)
+		}
+	}
+}
+
+func TestID3v1Transliteration(t *testing.T) {
+	defer func(transliterate func(string) string) { V1Transliteration = transliterate }(V1Transliteration)
+
+	for name, transliterate := range Transliterations {
+		V1Transliteration = transliterate
+		for _, fixture := range vietnameseFixtures {
+			want := fixture.ascii
+			if name == "viqr" {
+				want = fixture.viqr
+			}
+
+			path, cleanup := tempMP3(t, make([]byte, 1024))
+			writeTags(t, path, Metadata{Artist: fixture.nfd, Title: fixture.nfc})
+			data, err := ioutil.ReadFile(path)
+			cleanup()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tag := data[len(data)-128:]
+			if string(tag[:3]) != "TAG" {
+				t.Fatalf("%s: no ID3v1 tag at the end of the file", name)
+			}
+			title := string(bytes.TrimRight(tag[3:33], "\x00"))
+			artist := string(bytes.TrimRight(tag[33:63], "\x00"))
+			if title != want || artist != want {
+				t.Errorf("%s of %q = %q / %q, want %q", name, fixture.nfc, artist, title, want)
+			}
+		}
+	}
+}
+
+func TestRetaggingReplacesID3v1(t *testing.T) {
+	path, cleanup := tempMP3(t, make([]byte, 1024))
+	defer cleanup()
+	writeTags(t, path, Metadata{Title: "First"})
+	writeTags(t, path, Metadata{Title: "Second"})
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("TAG")); n != 1 {
+		t.Errorf("file has %d ID3v1 tags, want 1", n)
+	}
+	meta, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Title != "Second" {
+		t.Errorf("Title = %q, want %q", meta.Title, "Second")
+	}
+}
+
+func TestAudioIsKept(t *testing.T) {
+	audio := make([]byte, 200*1024)
+	for i := range audio {
+		audio[i] = byte(i % 251)
+	}
+	path, cleanup := tempMP3(t, audio)
+	defer cleanup()
+
+	// The second tag outgrows the first one's padding.
+	writeTags(t, path, Metadata{Title: "Lạc Trôi"})
+	writeTags(t, path, Metadata{Title: "Lạc Trôi", Artwork: bytes.Repeat([]byte{0xff}, 4096)})
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Pictures) != 1 {
+		t.Errorf("read %d pictures, want 1", len(meta.Pictures))
+	}
+	start := len(data) - 128 - len(audio)
+	if start < 0 || !bytes.Equal(data[start:len(data)-128], audio) {
+		t.Error("the audio was not kept between the ID3v2 and ID3v1 tags")
+	}
+}
+
+func TestID3v24IsReplaced(t *testing.T) {
+	// A v2.4 tag with a TIT2 frame of 200 bytes, whose synchsafe size id3-go misreads,
+	// and a footer.
+	text := bytes.Repeat([]byte("a"), 199)
+	frame := append([]byte("TIT2\x00\x00\x01\x48\x00\x00\x03"), text...)
+	size := len(frame) + 64
+	tag := append([]byte{'I', 'D', '3', 4, 0, 0x10, 0, 0, byte(size >> 7), byte(size & 0x7f)}, frame...)
+	tag = append(tag, make([]byte, 64)...)
+	tag = append(tag, '3', 'D', 'I', 4, 0, 0x10, 0, 0, byte(size>>7), byte(size&0x7f))
+	audio := bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x64}, 64)
+
+	for _, meta := range []Metadata{{Title: "Lạc Trôi", Artist: "Sơn Tùng M-TP"}, {Title: strings.TrimSpace(strings.Repeat("Lạc Trôi ", 100))}} {
+		path, cleanup := tempMP3(t, append(append([]byte{}, tag...), audio...))
+		writeTags(t, path, meta)
+
+		got, err := Read(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Version != "2.3.0" || got.Title != meta.Title || got.Artist != meta.Artist {
+			t.Errorf("read version %s, %q by %q; want 2.3.0, %q by %q", got.Version, got.Title, got.Artist, meta.Title, meta.Artist)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start := len(data) - 128 - len(audio); start < 0 || !bytes.Equal(data[start:len(data)-128], audio) {
+			t.Error("the audio was not kept after the new tag")
+		}
+		cleanup()
+	}
+}
+
+func TestVietnameseNFC(t *testing.T) {
+	cases := map[string]string{
+		"":                        "",
+		"plain ascii":             "plain ascii",
+		"ậ":                     "ậ",
+		"ậ":                     "ậ",
+		"ợ":                     "ợ",
+		"é":                      "é",
+		"û́":                     "û́",
+		"ä":                      "ä",
+		vietnameseFixtures[2].nfd: vietnameseFixtures[2].nfc,
+		vietnameseFixtures[2].nfc: vietnameseFixtures[2].nfc,
+	}
+	for input, want := range cases {
+		if got := VietnameseNFC(input); got != want {
+			t.Errorf("VietnameseNFC(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestReadCorruptFrame(t *testing.T) {
+	// A TIT2 frame whose text encoding byte is out of range makes id3-go panic.
+	frame := []byte("TIT2\x00\x00\x00\x04\x00\x00\xf6abc")
+	header := []byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, byte(len(frame))}
+	content := append(append(header, frame...), make([]byte, 1024)...)
+	path, cleanup := tempMP3(t, content)
+	defer cleanup()
+
+	if meta, err := Read(path); err == nil {
+		t.Errorf("Read = %+v, want an error", meta)
+	}
+}
@@ -0,0 +1,362 @@
+package tags
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Combining diacritics used in Vietnamese.
+const (
+	grave      = '\u0300'
+	acute      = '\u0301'
+	circumflex = '\u0302'
+	tilde      = '\u0303'
+	breve      = '\u0306'
+	hook       = '\u0309'
+	horn       = '\u031b'
+	dotBelow   = '\u0323'
+)
+
+// combiningClass holds the canonical combining class of the Vietnamese diacritics,
+// plus the deprecated tone marks U+0340 and U+0341, which normalize to grave and acute.
+var combiningClass = map[rune]int{
+	grave: 230, acute: 230, circumflex: 230, tilde: 230, breve: 230, hook: 230,
+	horn: 216, dotBelow: 220,
+	'\u0340': 230, '\u0341': 230,
+}
+
+// compositions are the canonical compositions of the Vietnamese letters, as in the
+// Unicode character database: a letter followed by a diacritic composes into a
+// precomposed letter, which may take a further diacritic in turn.
+var compositions = map[[2]rune]rune{
+	{'a', circumflex}: 'â',
+	{'a', breve}:      'ă',
+	{'a', grave}:      'à',
+	{'a', acute}:      'á',
+	{'a', hook}:       'ả',
+	{'a', tilde}:      'ã',
+	{'a', dotBelow}:   'ạ',
+
+	{'ă', grave}: 'ằ',
+	{'ă', acute}: 'ắ',
+	{'ă', hook}:  'ẳ',
+	{'ă', tilde}: 'ẵ',
+
+	{'â', grave}: 'ầ',
+	{'â', acute}: 'ấ',
+	{'â', hook}:  'ẩ',
+	{'â', tilde}: 'ẫ',
+
+	{'ạ', circumflex}: 'ậ',
+	{'ạ', breve}:      'ặ',
+
+	{'e', circumflex}: 'ê',
+	{'e', grave}:      'è',
+	{'e', acute}:      'é',
+	{'e', hook}:       'ẻ',
+	{'e', tilde}:      'ẽ',
+	{'e', dotBelow}:   'ẹ',
+
+	{'ê', grave}: 'ề',
+	{'ê', acute}: 'ế',
+	{'ê', hook}:  'ể',
+	{'ê', tilde}: 'ễ',
+
+	{'ẹ', circumflex}: 'ệ',
+
+	{'i', grave}:    'ì',
+	{'i', acute}:    'í',
+	{'i', hook}:     'ỉ',
+	{'i', tilde}:    'ĩ',
+	{'i', dotBelow}: 'ị',
+
+	{'o', circumflex}: 'ô',
+	{'o', horn}:       'ơ',
+	{'o', grave}:      'ò',
+	{'o', acute}:      'ó',
+	{'o', hook}:       'ỏ',
+	{'o', tilde}:      'õ',
+	{'o', dotBelow}:   'ọ',
+
+	{'ô', grave}: 'ồ',
+	{'ô', acute}: 'ố',
+	{'ô', hook}:  'ổ',
+	{'ô', tilde}: 'ỗ',
+
+	{'ơ', grave}:    'ờ',
+	{'ơ', acute}:    'ớ',
+	{'ơ', hook}:     'ở',
+	{'ơ', tilde}:    'ỡ',
+	{'ơ', dotBelow}: 'ợ',
+
+	{'ọ', circumflex}: 'ộ',
+
+	{'u', horn}:     'ư',
+	{'u', grave}:    'ù',
+	{'u', acute}:    'ú',
+	{'u', hook}:     'ủ',
+	{'u', tilde}:    'ũ',
+	{'u', dotBelow}: 'ụ',
+
+	{'ư', grave}:    'ừ',
+	{'ư', acute}:    'ứ',
+	{'ư', hook}:     'ử',
+	{'ư', tilde}:    'ữ',
+	{'ư', dotBelow}: 'ự',
+
+	{'y', grave}:    'ỳ',
+	{'y', acute}:    'ý',
+	{'y', hook}:     'ỷ',
+	{'y', tilde}:    'ỹ',
+	{'y', dotBelow}: 'ỵ',
+
+	{'A', circumflex}: 'Â',
+	{'A', breve}:      'Ă',
+	{'A', grave}:      'À',
+	{'A', acute}:      'Á',
+	{'A', hook}:       'Ả',
+	{'A', tilde}:      'Ã',
+	{'A', dotBelow}:   'Ạ',
+
+	{'Ă', grave}: 'Ằ',
+	{'Ă', acute}: 'Ắ',
+	{'Ă', hook}:  'Ẳ',
+	{'Ă', tilde}: 'Ẵ',
+
+	{'Â', grave}: 'Ầ',
+	{'Â', acute}: 'Ấ',
+	{'Â', hook}:  'Ẩ',
+	{'Â', tilde}: 'Ẫ',
+
+	{'Ạ', circumflex}: 'Ậ',
+	{'Ạ', breve}:      'Ặ',
+
+	{'E', circumflex}: 'Ê',
+	{'E', grave}:      'È',
+	{'E', acute}:      'É',
+	{'E', hook}:       'Ẻ',
+	{'E', tilde}:      'Ẽ',
+	{'E', dotBelow}:   'Ẹ',
+
+	{'Ê', grave}: 'Ề',
+	{'Ê', acute}: 'Ế',
+	{'Ê', hook}:  'Ể',
+	{'Ê', tilde}: 'Ễ',
+
+	{'Ẹ', circumflex}: 'Ệ',
+
+	{'I', grave}:    'Ì',
+	{'I', acute}:    'Í',
+	{'I', hook}:     'Ỉ',
+	{'I', tilde}:    'Ĩ',
+	{'I', dotBelow}: 'Ị',
+
+	{'O', circumflex}: 'Ô',
+	{'O', horn}:       'Ơ',
+	{'O', grave}:      'Ò',
+	{'O', acute}:      'Ó',
+	{'O', hook}:       'Ỏ',
+	{'O', tilde}:      'Õ',
+	{'O', dotBelow}:   'Ọ',
+
+	{'Ô', grave}: 'Ồ',
+	{'Ô', acute}: 'Ố',
+	{'Ô', hook}:  'Ổ',
+	{'Ô', tilde}: 'Ỗ',
+
+	{'Ơ', grave}:    'Ờ',
+	{'Ơ', acute}:    'Ớ',
+	{'Ơ', hook}:     'Ở',
+	{'Ơ', tilde}:    'Ỡ',
+	{'Ơ', dotBelow}: 'Ợ',
+
+	{'Ọ', circumflex}: 'Ộ',
+
+	{'U', horn}:     'Ư',
+	{'U', grave}:    'Ù',
+	{'U', acute}:    'Ú',
+	{'U', hook}:     'Ủ',
+	{'U', tilde}:    'Ũ',
+	{'U', dotBelow}: 'Ụ',
+
+	{'Ư', grave}:    'Ừ',
+	{'Ư', acute}:    'Ứ',
+	{'Ư', hook}:     'Ử',
+	{'Ư', tilde}:    'Ữ',
+	{'Ư', dotBelow}: 'Ự',
+
+	{'Y', grave}:    'Ỳ',
+	{'Y', acute}:    'Ý',
+	{'Y', hook}:     'Ỷ',
+	{'Y', tilde}:    'Ỹ',
+	{'Y', dotBelow}: 'Ỵ',
+}
+
+// decompositions maps every precomposed Vietnamese letter back to the letter and
+// diacritic it is composed of.
+var decompositions = make(map[rune][2]rune, len(compositions))
+
+func init() {
+	for pair, composed := range compositions {
+		decompositions[composed] = pair
+	}
+}
+
+// VietnameseNFC composes the Vietnamese letters of s the way Unicode normalization form
+// C does: letters spelled with combining diacritics, as decomposed (NFD) text and some
+// keyboards produce them, are replaced by their precomposed forms.
+//
+// It is not a general NFC implementation. Only the Vietnamese vowels and the
+// diacritics listed in combiningClass are composed; other decomposed text, e.g. with
+// U+0308 COMBINING DIAERESIS, is returned as it is.
+func VietnameseNFC(s string) string {
+	if !strings.ContainsAny(s, "\u0300\u0301\u0302\u0303\u0306\u0309\u031b\u0323\u0340\u0341") {
+		return s
+	}
+
+	runes := []rune(s)
+	out := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); {
+		base := runes[i]
+		i++
+
+		// Collect the diacritics following base in canonical order, i.e. stably
+		// sorted by combining class.
+		marks := []rune{}
+		for ; i < len(runes); i++ {
+			mark := runes[i]
+			class, ok := combiningClass[mark]
+			if !ok {
+				break
+			}
+			switch mark {
+			case '\u0340':
+				mark = grave
+			case '\u0341':
+				mark = acute
+			}
+			j := len(marks)
+			marks = append(marks, mark)
+			for ; j > 0 && combiningClass[marks[j-1]] > class; j-- {
+				marks[j] = marks[j-1]
+			}
+			marks[j] = mark
+		}
+
+		// Compose each diacritic into base unless an uncomposed diacritic of the same
+		// class precedes it, which blocks it.
+		rest := []rune{}
+		blocked := map[int]bool{}
+		for _, mark := range marks {
+			class := combiningClass[mark]
+			if composed, ok := compositions[[2]rune{base, mark}]; ok && !blocked[class] {
+				base = composed
+				continue
+			}
+			rest = append(rest, mark)
+			blocked[class] = true
+		}
+		out = append(out, base)
+		out = append(out, rest...)
+	}
+	return string(out)
+}
+
+// decompose returns the letter r is based on and its diacritics, outermost last.
+func decompose(r rune) (rune, []rune) {
+	marks := []rune{}
+	for {
+		pair, ok := decompositions[r]
+		if !ok {
+			break
+		}
+		r = pair[0]
+		marks = append([]rune{pair[1]}, marks...)
+	}
+	return r, marks
+}
+
+// asciiPunctuation replaces typographic punctuation common in titles.
+var asciiPunctuation = map[rune]string{
+	'‘': "'", '’': "'", '‚': ",", '“': `"`, '”': `"`, '„': `"`,
+	'–': "-", '—': "-", '…': "...", '«': `"`, '»': `"`, '•': "-",
+}
+
+// transliterate converts s to ASCII with letter, which spells the Vietnamese letter
+// base carrying marks. Other characters are replaced by their closest ASCII
+// punctuation, or a question mark.
+func transliterate(s string, letter func(buf *bytes.Buffer, base rune, marks []rune)) string {
+	buf := &bytes.Buffer{}
+	for _, r := range VietnameseNFC(s) {
+		switch {
+		case r < utf8.RuneSelf:
+			buf.WriteRune(r)
+		case r == 'đ' || r == 'Đ':
+			letter(buf, r, nil)
+		case decompositions[r] != [2]rune{}:
+			base, marks := decompose(r)
+			letter(buf, base, marks)
+		case asciiPunctuation[r] != "":
+			buf.WriteString(asciiPunctuation[r])
+		case unicode.IsSpace(r):
+			buf.WriteByte(' ')
+		case unicode.Is(unicode.Mn, r):
+			// Diacritics which did not compose are dropped.
+		default:
+			buf.WriteByte('?')
+		}
+	}
+	return buf.String()
+}
+
+// ASCII drops the diacritics of Vietnamese text, e.g. "Sơn Tùng" becomes "Son Tung".
+func ASCII(s string) string {
+	return transliterate(s, func(buf *bytes.Buffer, base rune, marks []rune) {
+		switch base {
+		case 'đ':
+			base = 'd'
+		case 'Đ':
+			base = 'D'
+		}
+		buf.WriteRune(base)
+	})
+}
+
+// viqrMarks spells the Vietnamese diacritics in VIQR.
+var viqrMarks = map[rune]byte{
+	circumflex: '^', breve: '(', horn: '+',
+	acute: '\'', grave: '`', hook: '?', tilde: '~', dotBelow: '.',
+}
+
+// VIQR spells Vietnamese text in VIQR, the ASCII convention writing diacritics as
+// the punctuation following a letter, e.g. "Sơn Tùng" becomes "So+n Tu`ng". Vowel
+// modifiers come before tone marks.
+func VIQR(s string) string {
+	return transliterate(s, func(buf *bytes.Buffer, base rune, marks []rune) {
+		switch base {
+		case 'đ':
+			buf.WriteString("dd")
+			return
+		case 'Đ':
+			buf.WriteString("DD")
+			return
+		}
+		buf.WriteRune(base)
+		for _, modifiers := range []bool{true, false} {
+			for _, mark := range marks {
+				isModifier := mark == circumflex || mark == breve || mark == horn
+				if isModifier == modifiers {
+					buf.WriteByte(viqrMarks[mark])
+				}
+			}
+		}
+	})
+}
+
+// Transliterations are the conversions to ASCII available for ID3v1 tags, by name.
+var Transliterations = map[string]func(string) string{
+	"ascii": ASCII,
+	"viqr":  VIQR,
+}
@@ -0,0 +1,244 @@
+// Package api is a client for the JSON API behind the current Zing MP3 site. Requests
+// carry a timestamp and an HMAC signature and need the session cookies handed out
+// by the home page, which the client fetches before its first call.
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultBaseURL is the site the API is served from.
+const DefaultBaseURL = "https://zingmp3.vn"
+
+// Endpoint paths.
+const (
+	songPath      = "/api/v2/page/get/song"
+	streamingPath = "/api/v2/song/get/streaming"
+	playlistPath  = "/api/v2/page/get/playlist"
+	lyricPath     = "/api/v2/lyric/get/lyric"
+)
+
+// signedParams are the query parameters covered by a request's signature.
+var signedParams = map[string]bool{
+	"count":   true,
+	"ctime":   true,
+	"id":      true,
+	"page":    true,
+	"type":    true,
+	"version": true,
+}
+
+// Client calls the Zing JSON API. APIKey, SecretKey and Version are those used by the
+// site's own web player.
+type Client struct {
+	// HTTPClient is used for every request. Its cookie jar is replaced by NewClient.
+	HTTPClient *http.Client
+	BaseURL    string
+
+	APIKey    string
+	SecretKey string
+	Version   string
+
+	// now returns the request time; replaced when signing must be reproducible.
+	now func() time.Time
+
+	mu           sync.Mutex
+	bootstrapped bool
+}
+
+// NewClient returns a Client with its own cookie jar, talking to DefaultBaseURL.
+func NewClient(apiKey, secretKey, version string) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		HTTPClient: &http.Client{Jar: jar, Timeout: 30 * time.Second},
+		BaseURL:    DefaultBaseURL,
+		APIKey:     apiKey,
+		SecretKey:  secretKey,
+		Version:    version,
+		now:        time.Now,
+	}
+}
+
+// Sign returns the signature of a request to path with the given query parameters:
+// the hex HMAC-SHA512, keyed with SecretKey, of path followed by the hex SHA-256
+// of the signed parameters concatenated in key order as key=value.
+func (c *Client) Sign(path string, params url.Values) string {
+	keys := []string{}
+	for key := range params {
+		if signedParams[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	message := ""
+	for _, key := range keys {
+		message += key + "=" + params.Get(key)
+	}
+	digest := sha256.Sum256([]byte(message))
+
+	mac := hmac.New(sha512.New, []byte(c.SecretKey))
+	mac.Write([]byte(path + hex.EncodeToString(digest[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// bootstrap loads the home page once so the cookie jar holds a session.
+func (c *Client) bootstrap(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.bootstrapped {
+		return nil
+	}
+
+	request, err := http.NewRequest("GET", c.BaseURL+"/", nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.HTTPClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("api: session bootstrap failed with status %d", response.StatusCode)
+	}
+
+	c.bootstrapped = true
+	return nil
+}
+
+// envelope is the wrapper around every API response.
+type envelope struct {
+	Err  int             `json:"err"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// get calls the endpoint at path and decodes its data into out. A call failing because
+// the session expired is retried once with a new session.
+func (c *Client) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	err := c.call(ctx, path, params, out)
+	if Is(err, ErrSessionExpired) {
+		err = c.call(ctx, path, params, out)
+	}
+	return err
+}
+
+// call makes a single signed request for get, starting a session first if needed.
+func (c *Client) call(ctx context.Context, path string, params url.Values, out interface{}) error {
+	if err := c.bootstrap(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("ctime", strconv.FormatInt(now().Unix(), 10))
+	params.Set("version", c.Version)
+	params.Set("sig", c.Sign(path, params))
+	params.Set("apiKey", c.APIKey)
+
+	request, err := http.NewRequest("GET", c.BaseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	response, err := c.HTTPClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("api: unexpected status %d from %s", response.StatusCode, path)
+	}
+
+	body := envelope{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return err
+	}
+	if body.Err != 0 {
+		if body.Err == codeSessionExpired {
+			// Start a new session on the next call, which get makes right away.
+			c.mu.Lock()
+			c.bootstrapped = false
+			c.mu.Unlock()
+		}
+		return newError(body.Err, body.Msg)
+	}
+	return json.Unmarshal(body.Data, out)
+}
+
+func idParams(id string) url.Values {
+	return url.Values{"id": {id}}
+}
+
+// Song returns the details of the song with the given ID.
+func (c *Client) Song(ctx context.Context, id string) (*Song, error) {
+	song := &Song{}
+	err := c.get(ctx, songPath, idParams(id), song)
+	if err != nil {
+		return nil, err
+	}
+	return song, nil
+}
+
+// Streaming returns the stream URLs of a song by quality, e.g. "128" and "320".
+// Qualities which need a VIP account are left out, and a song with none left
+// fails with ErrVIPOnly.
+func (c *Client) Streaming(ctx context.Context, id string) (Streams, error) {
+	raw := map[string]string{}
+	err := c.get(ctx, streamingPath, idParams(id), &raw)
+	if err != nil {
+		return nil, err
+	}
+
+	streams := Streams{}
+	vip := false
+	for quality, link := range raw {
+		if u, err := url.Parse(link); err == nil && u.IsAbs() {
+			streams[quality] = link
+		} else if link == "VIP" {
+			vip = true
+		}
+	}
+	if len(streams) == 0 && vip {
+		return nil, newError(codeVIPOnly, "no free stream")
+	}
+	return streams, nil
+}
+
+// Playlist returns the details and songs of the playlist or album with the given ID.
+func (c *Client) Playlist(ctx context.Context, id string) (*Playlist, error) {
+	playlist := &Playlist{}
+	err := c.get(ctx, playlistPath, idParams(id), playlist)
+	if err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// Lyrics returns the lyrics of the song with the given ID.
+func (c *Client) Lyrics(ctx context.Context, id string) (*Lyrics, error) {
+	lyrics := &Lyrics{}
+	err := c.get(ctx, lyricPath, idParams(id), lyrics)
+	if err != nil {
+		return nil, err
+	}
+	return lyrics, nil
+}
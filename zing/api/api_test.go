@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testKey     = "88265e23d4284f25963e6eedac8fbfa3"
+	testSecret  = "2aa2d1c561e809b267f3638c4a307aab"
+	testVersion = "1.6.34"
+	testTime    = 1500000000
+)
+
+func TestSign(t *testing.T) {
+	c := NewClient(testKey, testSecret, testVersion)
+
+	// Expected values computed independently from the documented scheme.
+	cases := []struct {
+		path   string
+		params url.Values
+		want   string
+	}{
+		{
+			songPath,
+			url.Values{"id": {"ZW9DBD6O"}, "ctime": {"1500000000"}, "version": {testVersion}},
+			"70dd061483e96961f09cb03df29879910ade46db8084df12a50995aa1e8cb34d61d25061e5039a2719f77a60f0c8c4cbbfde07b305a176e2d8a6e91c241adf08",
+		},
+		{
+			// apiKey and sig are sent but not signed; page and count are.
+			playlistPath,
+			url.Values{"id": {"ZOAE6CUW"}, "ctime": {"1500000000"}, "version": {testVersion}, "page": {"1"}, "count": {"20"}, "apiKey": {testKey}, "sig": {"ignored"}},
+			"04f76de9616acc0e9e54aa08b199f5f2857c01cfbde4cd3abc6507a3f67ba466c86e3fcd307e3f29defc7142c7094340dfcfc7e6e1c1670f1ffcefd12657ea95",
+		},
+	}
+	for _, c2 := range cases {
+		if got := c.Sign(c2.path, c2.params); got != c2.want {
+			t.Errorf("Sign(%s, %v) = %s, want %s", c2.path, c2.params, got, c2.want)
+		}
+	}
+}
+
+// apiServer serves recorded responses by endpoint path. The fixture of a path may be
+// changed between calls with set.
+type apiServer struct {
+	*httptest.Server
+	t *testing.T
+
+	mu         sync.Mutex
+	fixtures   map[string][]string // path -> fixtures served in turn, the last one repeated
+	bootstraps int
+	calls      map[string]int
+}
+
+func newAPIServer(t *testing.T, fixtures map[string][]string) *apiServer {
+	s := &apiServer{t: t, fixtures: fixtures, calls: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *apiServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.URL.Path == "/" {
+		s.bootstraps++
+		http.SetCookie(w, &http.Cookie{Name: "zmp3_rqid", Value: "session", Path: "/"})
+		return
+	}
+
+	fixtures, ok := s.fixtures[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := r.Cookie("zmp3_rqid"); err != nil {
+		s.t.Errorf("%s called without a session cookie", r.URL.Path)
+	}
+	query := r.URL.Query()
+	params := url.Values{}
+	for key := range query {
+		params.Set(key, query.Get(key))
+	}
+	want := (&Client{SecretKey: testSecret}).Sign(r.URL.Path, params)
+	if query.Get("sig") != want || query.Get("apiKey") != testKey || query.Get("ctime") != "1500000000" || query.Get("version") != testVersion {
+		s.t.Errorf("%s called with bad parameters %v", r.URL.Path, query)
+	}
+
+	n := s.calls[r.URL.Path]
+	s.calls[r.URL.Path]++
+	if n >= len(fixtures) {
+		n = len(fixtures) - 1
+	}
+	data, err := ioutil.ReadFile(filepath.Join("testdata", fixtures[n]))
+	if err != nil {
+		s.t.Error(err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
+
+func (s *apiServer) client() *Client {
+	c := NewClient(testKey, testSecret, testVersion)
+	c.BaseURL = s.URL
+	c.now = func() time.Time { return time.Unix(testTime, 0) }
+	return c
+}
+
+func TestSong(t *testing.T) {
+	s := newAPIServer(t, map[string][]string{songPath: {"song.json"}})
+	defer s.Close()
+
+	song, err := s.client().Song(context.Background(), "ZW9DBD6O")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if song.ID != "ZW9DBD6O" || song.Title != "Lạc Trôi" || song.ArtistsNames != "Sơn Tùng M-TP" {
+		t.Errorf("song = %s %q by %q", song.ID, song.Title, song.ArtistsNames)
+	}
+	if song.Duration != 233 || song.ReleaseDate != 1483290000 || !song.HasLyric || !song.IsWorldWide {
+		t.Errorf("duration %d, release %d, lyric %v, worldwide %v", song.Duration, song.ReleaseDate, song.HasLyric, song.IsWorldWide)
+	}
+	if song.Album == nil || song.Album.ID != "ZOAE6CUW" || song.Album.Title != "Lạc Trôi (Single)" {
+		t.Errorf("album = %+v", song.Album)
+	}
+	if len(song.Composers) != 1 || song.Composers[0].Name != "Sơn Tùng M-TP" {
+		t.Errorf("composers = %+v", song.Composers)
+	}
+	if !reflect.DeepEqual(song.GenreIDs, []string{"IWZ9Z08I", "IWZ97FCD"}) || len(song.Genres) != 2 || song.Genres[1].Title != "V-Pop" {
+		t.Errorf("genre IDs %v, genres %+v", song.GenreIDs, song.Genres)
+	}
+	if s.bootstraps != 1 {
+		t.Errorf("%d session bootstraps, want 1", s.bootstraps)
+	}
+}
+
+func TestStreaming(t *testing.T) {
+	s := newAPIServer(t, map[string][]string{streamingPath: {"streaming.json", "streaming_vip.json"}})
+	defer s.Close()
+	c := s.client()
+
+	streams, err := c.Streaming(context.Background(), "ZW9DBD6O")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(streams) != 1 || streams["128"] == "" {
+		t.Errorf("streams = %v, want only the free 128 kbps one", streams)
+	}
+
+	_, err = c.Streaming(context.Background(), "ZW9DCE0A")
+	if !Is(err, ErrVIPOnly) {
+		t.Errorf("VIP only song: error %v, want %v", err, ErrVIPOnly)
+	}
+}
+
+func TestPlaylist(t *testing.T) {
+	s := newAPIServer(t, map[string][]string{playlistPath: {"playlist.json"}})
+	defer s.Close()
+
+	playlist, err := s.client().Playlist(context.Background(), "ZOAE6CUW")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if playlist.Title != "Lạc Trôi (Single)" || playlist.ReleaseDate != "01/01/2017" || playlist.Songs.Total != 2 {
+		t.Errorf("playlist %q released %q with %d songs", playlist.Title, playlist.ReleaseDate, playlist.Songs.Total)
+	}
+	if len(playlist.Songs.Items) != 2 || playlist.Songs.Items[1].StreamingStatus != 2 || len(playlist.Songs.Items[1].Artists) != 2 {
+		t.Errorf("songs = %+v", playlist.Songs.Items)
+	}
+}
+
+func TestLyrics(t *testing.T) {
+	s := newAPIServer(t, map[string][]string{lyricPath: {"lyric.json"}})
+	defer s.Close()
+
+	lyrics, err := s.client().Lyrics(context.Background(), "ZW9DBD6O")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lyrics.File == "" || len(lyrics.Sentences) != 2 || len(lyrics.Sentences[0].Words) != 4 {
+		t.Fatalf("lyrics = %+v", lyrics)
+	}
+	if word := lyrics.Sentences[0].Words[0]; word.Data != "Người" || word.Start != 20380 || word.End != 20830 {
+		t.Errorf("first word = %+v", word)
+	}
+}
+
+func TestErrorCodes(t *testing.T) {
+	s := newAPIServer(t, map[string][]string{songPath: {"not_found.json"}})
+	defer s.Close()
+
+	_, err := s.client().Song(context.Background(), "ZW000000")
+	apiErr, ok := err.(*Error)
+	if !ok || apiErr.Code != codeNotFound || !Is(err, ErrNotFound) {
+		t.Errorf("error %#v, want code %d", err, codeNotFound)
+	}
+}
+
+func TestSessionExpiredRetriesOnce(t *testing.T) {
+	s := newAPIServer(t, map[string][]string{songPath: {"session_expired.json", "song.json"}})
+	defer s.Close()
+
+	song, err := s.client().Song(context.Background(), "ZW9DBD6O")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if song.Title != "Lạc Trôi" {
+		t.Errorf("title %q", song.Title)
+	}
+	if s.bootstraps != 2 || s.calls[songPath] != 2 {
+		t.Errorf("%d bootstraps and %d calls, want 2 of each", s.bootstraps, s.calls[songPath])
+	}
+}
+
+func TestSessionExpiredGivesUp(t *testing.T) {
+	s := newAPIServer(t, map[string][]string{songPath: {"session_expired.json"}})
+	defer s.Close()
+
+	_, err := s.client().Song(context.Background(), "ZW9DBD6O")
+	if !Is(err, ErrSessionExpired) {
+		t.Errorf("error %v, want %v", err, ErrSessionExpired)
+	}
+	if s.calls[songPath] != 2 {
+		t.Errorf("%d calls, want the failed one and a single retry", s.calls[songPath])
+	}
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error codes returned in the "err" field of API responses.
+const (
+	codeNotFound       = -1023
+	codeSessionExpired = -201
+	codeVIPOnly        = -1150
+	codeRegionBlocked  = -1110
+	codeRemoved        = -1050
+)
+
+// Errors for the API error codes callers usually handle.
+var (
+	ErrNotFound       = errors.New("api: not found")
+	ErrSessionExpired = errors.New("api: session expired")
+	ErrVIPOnly        = errors.New("api: only available to VIP accounts")
+	ErrRegionBlocked  = errors.New("api: not available in this region")
+	ErrRemoved        = errors.New("api: removed by the copyright owner")
+)
+
+var codeErrors = map[int]error{
+	codeNotFound:       ErrNotFound,
+	codeSessionExpired: ErrSessionExpired,
+	codeVIPOnly:        ErrVIPOnly,
+	codeRegionBlocked:  ErrRegionBlocked,
+	codeRemoved:        ErrRemoved,
+}
+
+// Error is an error code returned by the API.
+type Error struct {
+	Code    int
+	Message string
+	// Kind is one of the package's Err values for known codes, otherwise nil.
+	Kind error
+}
+
+func newError(code int, message string) *Error {
+	return &Error{Code: code, Message: message, Kind: codeErrors[code]}
+}
+
+func (e *Error) Error() string {
+	if e.Kind != nil {
+		return fmt.Sprintf("%v (code %d: %s)", e.Kind, e.Code, e.Message)
+	}
+	return fmt.Sprintf("api: error code %d: %s", e.Code, e.Message)
+}
+
+// Is reports whether err is an API error of the given kind, e.g. Is(err, ErrVIPOnly).
+func Is(err error, kind error) bool {
+	if e, ok := err.(*Error); ok {
+		return e.Kind == kind
+	}
+	return err == kind
+}
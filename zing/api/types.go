@@ -0,0 +1,82 @@
+package api
+
+// Artist is an artist as listed on songs and playlists.
+type Artist struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Alias string `json:"alias"`
+	Link  string `json:"link"`
+}
+
+// Genre is a genre as listed on songs.
+type Genre struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Title string `json:"title"`
+	Alias string `json:"alias"`
+	Link  string `json:"link"`
+}
+
+// AlbumRef is the album a song belongs to.
+type AlbumRef struct {
+	ID    string `json:"encodeId"`
+	Title string `json:"title"`
+	Link  string `json:"link"`
+}
+
+// Song is a song's details.
+type Song struct {
+	ID           string    `json:"encodeId"`
+	Title        string    `json:"title"`
+	ArtistsNames string    `json:"artistsNames"`
+	Artists      []Artist  `json:"artists"`
+	Composers    []Artist  `json:"composers"`
+	Link         string    `json:"link"`
+	Thumbnail    string    `json:"thumbnailM"`
+	Duration     int       `json:"duration"`
+	Album        *AlbumRef `json:"album"`
+	ReleaseDate  int64     `json:"releaseDate"`
+	GenreIDs     []string  `json:"genreIds"`
+	// Genres names the genres of GenreIDs; some responses only carry the IDs.
+	Genres   []Genre `json:"genres"`
+	HasLyric bool    `json:"hasLyric"`
+	// StreamingStatus is 2 for songs which only VIP accounts may play.
+	StreamingStatus int  `json:"streamingStatus"`
+	IsWorldWide     bool `json:"isWorldWide"`
+}
+
+// Streams maps a quality in kbps, e.g. "128", to a stream URL.
+type Streams map[string]string
+
+// Playlist is a playlist or album with its songs.
+type Playlist struct {
+	ID           string   `json:"encodeId"`
+	Title        string   `json:"title"`
+	ArtistsNames string   `json:"artistsNames"`
+	Artists      []Artist `json:"artists"`
+	Link         string   `json:"link"`
+	Thumbnail    string   `json:"thumbnailM"`
+	ReleaseDate  string   `json:"releaseDate"`
+	Songs        struct {
+		Items []Song `json:"items"`
+		Total int    `json:"total"`
+	} `json:"song"`
+}
+
+// LyricWord is a word of a synchronised lyric line, timed in milliseconds.
+type LyricWord struct {
+	Start int    `json:"startTime"`
+	End   int    `json:"endTime"`
+	Data  string `json:"data"`
+}
+
+// LyricLine is a line of synchronised lyrics.
+type LyricLine struct {
+	Words []LyricWord `json:"words"`
+}
+
+// Lyrics are a song's lyrics, as an LRC file and, when available, timed lines.
+type Lyrics struct {
+	File      string      `json:"file"`
+	Sentences []LyricLine `json:"sentences"`
+}
@@ -0,0 +1,288 @@
+package zing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	// Registered for image.Decode; covers are served as JPEG or PNG, sometimes GIF.
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ArtworkName is the filename album covers are saved as, next to the album's tracks.
+const ArtworkName = "cover.jpg"
+
+// DefaultArtworkSize is the largest width or height of artwork by default. Many car
+// stereos and older players refuse to show larger covers.
+const DefaultArtworkSize = 600
+
+const (
+	// maxArtworkBytes bounds how much of an image is read.
+	maxArtworkBytes = 16 << 20
+	// maxArtworkPixels bounds the size of the images decoded, which take 4 bytes
+	// per pixel or more once decoded.
+	maxArtworkPixels = 6000 * 6000
+	// maxArtworkCache bounds the number of covers a Client remembers.
+	maxArtworkCache = 64
+	artworkQuality  = 90
+)
+
+var (
+	errUnsupportedArtwork = errors.New("unsupported artwork format")
+	errArtworkTooLarge    = errors.New("artwork is too large")
+)
+
+var (
+	// resizedArtwork matches the size prefix of Zing's image resizing proxy, as in
+	// photo-resize-zmp3.zadn.vn/w240_r1x1_jpeg/cover/...
+	resizedArtwork = regexp.MustCompile(`^/w\d+(_r\d+x\d+)?(_[a-z]+)?/`)
+	// thumbArtwork matches the size segment of the old zing.vn thumbnails, as in
+	// image.mp3.zdn.vn/thumb/165_165/covers/...
+	thumbArtwork = regexp.MustCompile(`/thumb/\d+_\d+/`)
+	// resizeHost matches the host of the resizing proxy, whose originals are served
+	// from the same host without the prefix.
+	resizeHost = regexp.MustCompile(`^photo-resize-`)
+)
+
+// artworkCandidates returns the URLs artworkURL may also be served at in a larger
+// size, followed by artworkURL itself.
+func artworkCandidates(artworkURL string) []string {
+	candidates := []string{}
+	if u, err := url.Parse(artworkURL); err == nil {
+		if resizedArtwork.MatchString(u.Path) {
+			original := *u
+			original.Path = resizedArtwork.ReplaceAllString(u.Path, "/")
+			original.Host = resizeHost.ReplaceAllString(u.Host, "photo-")
+			candidates = append(candidates, original.String())
+		} else if thumbArtwork.MatchString(u.Path) {
+			original := *u
+			original.Path = thumbArtwork.ReplaceAllString(u.Path, "/")
+			candidates = append(candidates, original.String())
+		}
+	}
+	return append(candidates, artworkURL)
+}
+
+// artworkCache remembers the covers fetched by a Client, as albums share theirs
+// between all of their tracks. Failed fetches are not remembered.
+type artworkCache struct {
+	group flightGroup
+
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func (a *artworkCache) get(key string) ([]byte, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	data, ok := a.entries[key]
+	return data, ok
+}
+
+func (a *artworkCache) add(key string, data []byte) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.entries == nil {
+		a.entries = make(map[string][]byte)
+	}
+	if len(a.entries) >= maxArtworkCache {
+		for key := range a.entries {
+			delete(a.entries, key)
+			break
+		}
+	}
+	a.entries[key] = data
+}
+
+// Artwork fetches the cover at artworkURL as a JPEG, preferring the largest size the
+// image host offers and scaling it down to ArtworkSize. Concurrent calls for the same
+// cover share one fetch, which is only cancelled once every caller has given up.
+func (c *Client) Artwork(ctx context.Context, artworkURL string) ([]byte, error) {
+	if artworkURL == "" {
+		return nil, errInvalidURL
+	}
+
+	key := fmt.Sprintf("%d %s", c.ArtworkSize, artworkURL)
+	if data, ok := c.artwork.get(key); ok {
+		return data, nil
+	}
+	data, _, err := c.artwork.group.Do(ctx, key, func(ctx context.Context) (interface{}, error) {
+		data, err := c.fetchArtwork(ctx, artworkURL)
+		if err == nil {
+			c.artwork.add(key, data)
+		}
+		return data, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data.([]byte), nil
+}
+
+func (c *Client) fetchArtwork(ctx context.Context, artworkURL string) ([]byte, error) {
+	var best []byte
+	var bestArea int
+	var firstErr error
+	for _, candidate := range artworkCandidates(artworkURL) {
+		var data []byte
+		_, err := c.Fetch(ctx, candidate, func(response *http.Response) error {
+			var err error
+			data, err = ioutil.ReadAll(io.LimitReader(response.Body, maxArtworkBytes))
+			return err
+		})
+		var config image.Config
+		if err == nil {
+			config, _, err = image.DecodeConfig(bytes.NewReader(data))
+		}
+		if err == nil && tooManyPixels(config) {
+			err = errArtworkTooLarge
+		}
+		if err != nil {
+			Logger.Debug("Unable to fetch artwork", "artwork_url", candidate, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if area := config.Width * config.Height; area > bestArea {
+			best, bestArea = data, area
+		}
+	}
+	if best == nil {
+		return nil, firstErr
+	}
+	return encodeArtwork(best, c.ArtworkSize)
+}
+
+// encodeArtwork returns data as a JPEG no wider or taller than maxSize, or as large
+// as it is when maxSize is zero. JPEGs which already fit are returned unchanged.
+func encodeArtwork(data []byte, maxSize int) ([]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errUnsupportedArtwork
+	}
+	if tooManyPixels(config) {
+		return nil, errArtworkTooLarge
+	}
+	width, height := config.Width, config.Height
+	if maxSize > 0 && (width > maxSize || height > maxSize) {
+		if width >= height {
+			width, height = maxSize, height*maxSize/width
+		} else {
+			width, height = width*maxSize/height, maxSize
+		}
+	} else if format == "jpeg" {
+		return data, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	err = jpeg.Encode(buf, scaleImage(img, width, height), &jpeg.Options{Quality: artworkQuality})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// tooManyPixels reports whether an image is too large to decode. Compressed images
+// can be far smaller than the memory they expand to.
+func tooManyPixels(config image.Config) bool {
+	return int64(config.Width)*int64(config.Height) > maxArtworkPixels
+}
+
+// scaleImage resamples src to width by height by averaging the source pixels
+// covering each destination pixel, flattening transparency onto white since JPEG
+// has none.
+func scaleImage(src image.Image, width, height int) *image.RGBA {
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcHeight/height
+		y1 := bounds.Min.Y + (y+1)*srcHeight/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcWidth/width
+			x1 := bounds.Min.X + (x+1)*srcWidth/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			// Colors are alpha premultiplied, so adding the missing alpha blends onto white.
+			white := 0xffff*n - a
+			dst.Set(x, y, color.RGBA64{
+				R: uint16((r + white) / n),
+				G: uint16((g + white) / n),
+				B: uint16((b + white) / n),
+				A: 0xffff,
+			})
+		}
+	}
+	return dst
+}
+
+// ArtworkURL returns the cover of the item found by an Enricher, if any.
+func (i *AlbumItem) ArtworkURL() string {
+	if i.Meta == nil {
+		return ""
+	}
+	return i.Meta.ArtworkURL
+}
+
+// CoverURL returns the album's cover, falling back to the first item with one.
+func (a *Album) CoverURL() string {
+	if a.ArtworkURL != "" {
+		return a.ArtworkURL
+	}
+	for i := range a.Items {
+		if artworkURL := a.Items[i].ArtworkURL(); artworkURL != "" {
+			return artworkURL
+		}
+	}
+	return ""
+}
+
+// SaveArtwork saves the cover at artworkURL into downloadDir as ArtworkName and
+// returns the file's path.
+func (c *Client) SaveArtwork(ctx context.Context, artworkURL, downloadDir string) (string, error) {
+	data, err := c.Artwork(ctx, artworkURL)
+	if err != nil {
+		return "", err
+	}
+	os.Mkdir(downloadDir, os.ModePerm)
+	path := filepath.Join(downloadDir, ArtworkName)
+	return path, ioutil.WriteFile(path, data, 0644)
+}
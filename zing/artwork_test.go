@@ -0,0 +1,67 @@
+package zing
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// pngClaiming returns a PNG whose header claims width by height pixels.
+func pngClaiming(t *testing.T, width, height uint32) []byte {
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// The IHDR chunk follows the 8 byte signature: length, type, width, height, ..., CRC.
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestEncodeArtworkRejectsHugeImages(t *testing.T) {
+	if _, err := encodeArtwork(pngClaiming(t, 100000, 100000), DefaultArtworkSize); err != errArtworkTooLarge {
+		t.Errorf("encodeArtwork = %v, want %v", err, errArtworkTooLarge)
+	}
+	if _, err := encodeArtwork(pngClaiming(t, 1, 1), DefaultArtworkSize); err != nil {
+		t.Errorf("encodeArtwork of a 1x1 PNG = %v", err)
+	}
+}
+
+func TestArtworkSurvivesCancelledCaller(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngClaiming(t, 1, 1))
+	}))
+	defer srv.Close()
+	client := testClient(testPolicy())
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for _, ctx := range []context.Context{first, context.Background()} {
+		go func(ctx context.Context) {
+			_, err := client.Artwork(ctx, srv.URL+"/cover.png")
+			errs <- err
+		}(ctx)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	cancelFirst()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("cancelled caller got %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	if err := <-errs; err != nil {
+		t.Errorf("the other caller got %v, want the artwork", err)
+	}
+}
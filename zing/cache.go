@@ -0,0 +1,292 @@
+package zing
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Taik/zing-mp3/provider"
+)
+
+// DefaultCacheTTL is how long parsed albums are kept by a Parser when no TTL is given.
+const DefaultCacheTTL = 10 * time.Minute
+
+// Cache stores parsed albums keyed by their Zing URL.
+type Cache interface {
+	// Get returns the album stored under key, if present and not expired.
+	Get(key string) (*Album, bool)
+	// Set stores album under key for ttl. A zero ttl never expires.
+	Set(key string, album *Album, ttl time.Duration)
+}
+
+// copyAlbum returns a copy of album which does not share its Items with the original.
+func copyAlbum(album *Album) *Album {
+	c := *album
+	c.Items = append([]AlbumItem(nil), album.Items...)
+	return &c
+}
+
+func expiryFor(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func expired(expires time.Time) bool {
+	return !expires.IsZero() && time.Now().After(expires)
+}
+
+type memoryEntry struct {
+	key     string
+	album   *Album
+	expires time.Time
+}
+
+// MemoryCache is an in-memory Cache which evicts the least recently used entry once full.
+type MemoryCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// NewMemoryCache returns a MemoryCache holding at most size albums.
+func NewMemoryCache(size int) *MemoryCache {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get implements Cache.
+func (c *MemoryCache) Get(key string) (*Album, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*memoryEntry)
+	if expired(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return copyAlbum(entry.album), true
+}
+
+// Set implements Cache.
+func (c *MemoryCache) Set(key string, album *Album, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &memoryEntry{
+		key:     key,
+		album:   copyAlbum(album),
+		expires: expiryFor(ttl),
+	}
+	if el, ok := c.entries[key]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*memoryEntry).key)
+	}
+}
+
+// Len returns the number of albums currently held by the cache.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+type diskEntry struct {
+	Key     string    `json:"key"`
+	Expires time.Time `json:"expires"`
+	Album   *Album    `json:"album"`
+}
+
+// DiskCache is a Cache which persists albums as JSON files in a directory,
+// so results survive restarts and can be shared between processes.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a DiskCache storing its entries in dir, creating it if needed.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir: dir}, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// Get implements Cache.
+func (c *DiskCache) Get(key string) (*Album, bool) {
+	path := c.path(key)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	entry := diskEntry{}
+	err = json.Unmarshal(data, &entry)
+	if err != nil || entry.Key != key || entry.Album == nil {
+		Logger.Warn("Discarding unreadable cache entry",
+			"cache_path", path,
+			"error", err,
+		)
+		os.Remove(path)
+		return nil, false
+	}
+	if expired(entry.Expires) {
+		os.Remove(path)
+		return nil, false
+	}
+	return entry.Album, true
+}
+
+// Set implements Cache.
+func (c *DiskCache) Set(key string, album *Album, ttl time.Duration) {
+	data, err := json.Marshal(diskEntry{
+		Key:     key,
+		Expires: expiryFor(ttl),
+		Album:   album,
+	})
+	if err != nil {
+		Logger.Error("Unable to encode cache entry", "key", key, "error", err)
+		return
+	}
+
+	// Write to a temporary file first so readers never see a partial entry.
+	path := c.path(key)
+	tmp, err := ioutil.TempFile(c.dir, ".tmp-")
+	if err != nil {
+		Logger.Error("Unable to write cache entry", "cache_path", path, "error", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		Logger.Error("Unable to write cache entry", "cache_path", path, "error", err)
+	}
+}
+
+// Parser parses albums through a Cache, collapsing concurrent lookups of the same URL
+// into a single request to Zing.
+type Parser struct {
+	// Client fetches albums on cache misses. It defaults to DefaultClient.
+	Client *Client
+
+	cache Cache
+	ttl   time.Duration
+	group flightGroup
+}
+
+// NewParser returns a Parser backed by cache. A nil cache only deduplicates concurrent lookups.
+func NewParser(cache Cache, ttl time.Duration) *Parser {
+	if ttl == 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Parser{
+		cache: cache,
+		ttl:   ttl,
+	}
+}
+
+// DefaultParser is the Parser used by DownloadAlbum.
+var DefaultParser = NewParser(nil, 0)
+
+func (p *Parser) client() *Client {
+	if p.Client == nil {
+		return DefaultClient
+	}
+	return p.Client
+}
+
+// resolve fetches the album at rawURL from the registered provider handling it,
+// or by scraping it as a Zing page when none does.
+func (p *Parser) resolve(ctx context.Context, rawURL string) (*Album, error) {
+	start := time.Now()
+	var album *Album
+	prov, err := provider.Lookup(rawURL)
+	if err == nil {
+		var collection *provider.Collection
+		collection, err = prov.Resolve(ctx, rawURL)
+		if err == nil {
+			album = NewAlbum(collection)
+		}
+	} else {
+		album, err = p.client().resolveAlbum(ctx, rawURL)
+	}
+	DefaultMetrics.ObserveParse(time.Since(start), err)
+	return album, err
+}
+
+// Parse behaves like ParseAlbumData but serves results from the cache when possible,
+// and resolves URLs of other sites through their registered provider.
+// Every album returned is reported to the client's Observer.
+//
+// Cancelling ctx makes Parse return ctx.Err(). The lookup itself, which concurrent
+// calls for the same URL share, is only cancelled when all of them have been.
+func (p *Parser) Parse(ctx context.Context, zingURL string) (*Album, error) {
+	observer := p.client().observer()
+
+	if p.cache != nil {
+		if album, ok := p.cache.Get(zingURL); ok {
+			Logger.Debug("Album data served from cache", "zing_url", zingURL)
+			observer.AlbumParsed(album)
+			return album, nil
+		}
+	}
+
+	value, shared, err := p.group.Do(ctx, zingURL, func(ctx context.Context) (interface{}, error) {
+		album, err := p.resolve(ctx, zingURL)
+		if err == nil && p.cache != nil {
+			p.cache.Set(zingURL, album, p.ttl)
+		}
+		return album, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if shared {
+		Logger.Debug("Album data shared with concurrent lookup", "zing_url", zingURL)
+	}
+	album := copyAlbum(value.(*Album))
+	observer.AlbumParsed(album)
+	return album, nil
+}
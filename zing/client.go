@@ -0,0 +1,432 @@
+package zing
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/Taik/zing-mp3/tags"
+	"github.com/Taik/zing-mp3/zing/api"
+)
+
+// Client talks to Zing and its CDN, retrying transient failures according to Retry.
+type Client struct {
+	// HTTPClient is used for every request. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// Retry is the retry and circuit breaker policy applied to every request.
+	Retry RetryPolicy
+	// Observer receives parse and download events. It may be nil.
+	Observer Observer
+	// Concurrency limits how many items DownloadAlbum fetches at once. Zero means no limit.
+	Concurrency int
+	// SkipTags leaves downloaded files as they were served, without writing ID3 tags.
+	SkipTags bool
+	// SkipArtwork leaves out cover art, both the embedded cover and the album's ArtworkName.
+	SkipArtwork bool
+	// ArtworkSize is the largest width or height of cover art; larger covers are scaled
+	// down. Zero keeps covers as large as they are served.
+	ArtworkSize int
+	// API, when set, is used to parse albums whose pages could not be scraped.
+	API *api.Client
+	// Enricher, when set, looks up the metadata of every item before DownloadAlbum
+	// downloads them, so their files are tagged with it.
+	Enricher *Enricher
+
+	breakers breakers
+	artwork  artworkCache
+}
+
+// NewClient returns a Client using http.DefaultClient and DefaultRetryPolicy.
+func NewClient() *Client {
+	return &Client{
+		HTTPClient:  http.DefaultClient,
+		Retry:       DefaultRetryPolicy,
+		ArtworkSize: DefaultArtworkSize,
+	}
+}
+
+// DefaultClient is the Client used by the package level functions.
+var DefaultClient = NewClient()
+
+// ItemResult is the outcome of downloading a single album item.
+type ItemResult struct {
+	Item     AlbumItem `json:"item"`
+	Path     string    `json:"path,omitempty"`
+	Bytes    int64     `json:"bytes"`
+	Attempts []Attempt `json:"attempts"`
+	Err      error     `json:"-"`
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) observer() Observer {
+	if c.Observer == nil {
+		return NopObserver{}
+	}
+	return c.Observer
+}
+
+// Fetch GETs rawURL and hands a 200 response to handle, retrying the whole exchange
+// while the failure, including one returned by handle, is retryable. Every attempt is
+// returned, whether or not the operation eventually succeeded.
+//
+// The request counts once towards the host's circuit breaker, as a failure if its last
+// attempt failed retryably. A request probing an open circuit is not retried.
+func (c *Client) Fetch(ctx context.Context, rawURL string, handle func(*http.Response) error) ([]Attempt, error) {
+	host := hostOf(rawURL)
+	maxAttempts := c.Retry.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	attempts := []Attempt{}
+	allowed, probe := c.breakers.Allow(host, c.Retry)
+	if !allowed {
+		return attempts, upstreamError(ErrCircuitOpen)
+	}
+	if probe {
+		maxAttempts = 1
+		defer c.breakers.EndProbe(host)
+	}
+
+	for n := 1; ; n++ {
+		if n > 1 && c.breakers.Open(host, c.Retry) {
+			return attempts, upstreamError(ErrCircuitOpen)
+		}
+
+		attempt := Attempt{URL: rawURL, Start: time.Now()}
+		err := c.fetchOnce(ctx, rawURL, handle, &attempt)
+		attempt.Duration = time.Since(attempt.Start)
+
+		if err == nil {
+			c.breakers.Record(host, false, c.Retry)
+			return append(attempts, attempt), nil
+		}
+		if ctx.Err() != nil {
+			attempt.Error = ctx.Err().Error()
+			return append(attempts, attempt), ctx.Err()
+		}
+
+		attempt.Error = err.Error()
+		upstreamError(err)
+		retryable := IsRetryable(err)
+		if !retryable || n >= maxAttempts {
+			c.breakers.Record(host, retryable, c.Retry)
+			return append(attempts, attempt), err
+		}
+
+		attempt.Backoff = c.Retry.backoff(n, err)
+		attempts = append(attempts, attempt)
+		Logger.Warn("Retrying upstream request",
+			"url", rawURL,
+			"attempt", n,
+			"backoff", attempt.Backoff,
+			"error", err,
+		)
+		if err := sleepContext(ctx, attempt.Backoff); err != nil {
+			return attempts, err
+		}
+	}
+}
+
+func (c *Client) fetchOnce(ctx context.Context, rawURL string, handle func(*http.Response) error, attempt *Attempt) error {
+	request, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.httpClient().Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	attempt.StatusCode = response.StatusCode
+	if response.StatusCode != http.StatusOK {
+		return &StatusError{
+			URL:        rawURL,
+			StatusCode: response.StatusCode,
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
+	}
+	return handle(response)
+}
+
+// ParseAlbum parses a zing MP3 URL and returns the Album associated with the current player on the page.
+func (c *Client) ParseAlbum(ctx context.Context, zingURL string) (*Album, error) {
+	start := time.Now()
+	album, err := c.resolveAlbum(ctx, zingURL)
+	DefaultMetrics.ObserveParse(time.Since(start), err)
+	if err == nil {
+		c.observer().AlbumParsed(album)
+	}
+	return album, err
+}
+
+// resolveAlbum scrapes the album at zingURL, falling back to the JSON API when possible,
+// without reporting to metrics or the observer.
+func (c *Client) resolveAlbum(ctx context.Context, zingURL string) (*Album, error) {
+	album, err := c.parseAlbum(ctx, zingURL)
+	if err != nil && c.canFallBack(ctx, err) {
+		Logger.Warn("Scraping album failed, falling back to the JSON API",
+			"zing_url", zingURL,
+			"error", err,
+		)
+		album, err = c.parseAlbumAPI(ctx, zingURL)
+	}
+	return album, unavailable(err)
+}
+
+func (c *Client) parseAlbum(ctx context.Context, zingURL string) (*Album, error) {
+	if zingURL == "" {
+		Logger.Error("Invalid album data URL",
+			"zing_url", zingURL,
+		)
+		return nil, errInvalidURL
+	}
+	Logger.Debug("Parsing for album data URL",
+		"zing_url", zingURL,
+	)
+
+	var doc *goquery.Document
+	_, err := c.Fetch(ctx, zingURL, func(response *http.Response) error {
+		var err error
+		doc, err = goquery.NewDocumentFromResponse(response)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dataXMLURL, found := doc.Find("div#html5player").Attr("data-xml")
+	if found == false {
+		return nil, upstreamError(errNoPlayerFound)
+	}
+
+	Logger.Debug("Found zing album data URL",
+		"album_data_xml", dataXMLURL,
+	)
+
+	var album *Album
+	_, err = c.Fetch(ctx, dataXMLURL, func(response *http.Response) error {
+		album = &Album{}
+		return xml.NewDecoder(response.Body).Decode(album)
+	})
+	if err != nil {
+		return nil, err
+	}
+	album.Items, err = c.playableItems(ctx, album.Items)
+	if err != nil {
+		return nil, err
+	}
+	album.ArtworkURL, _ = doc.Find(`meta[property="og:image"]`).Attr("content")
+	return album, nil
+}
+
+// downloadFile fetches item into downloadDir and returns the open file.
+func (c *Client) downloadFile(ctx context.Context, item *AlbumItem, downloadDir string) (*os.File, int64, []Attempt, error) {
+	start := time.Now()
+	os.Mkdir(downloadDir, os.ModePerm)
+
+	fd, err := os.Create(filepath.Join(downloadDir, item.Name()))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	var n int64
+	attempts, err := c.Fetch(ctx, item.DownloadURL, func(response *http.Response) error {
+		// Start over on every attempt so a retried download never appends to a partial one.
+		_, err := fd.Seek(0, io.SeekStart)
+		if err == nil {
+			err = fd.Truncate(0)
+		}
+		if err == nil {
+			n, err = io.Copy(fd, &progressReader{
+				r:        response.Body,
+				item:     *item,
+				total:    response.ContentLength,
+				observer: c.observer(),
+			})
+		}
+		return err
+	})
+	err = unavailable(err)
+	DefaultMetrics.ObserveDownload(time.Since(start), n, err)
+	if err != nil {
+		fd.Close()
+		os.Remove(fd.Name())
+		return nil, n, attempts, err
+	}
+	return fd, n, attempts, nil
+}
+
+// DownloadItem downloads and tags a single item into downloadDir.
+func (c *Client) DownloadItem(ctx context.Context, item AlbumItem, downloadDir string) ItemResult {
+	return c.downloadItem(ctx, item, downloadDir, item.ArtworkURL())
+}
+
+// downloadItem is DownloadItem embedding the cover at artworkURL.
+func (c *Client) downloadItem(ctx context.Context, item AlbumItem, downloadDir, artworkURL string) ItemResult {
+	Logger.Info("Processing item",
+		"artist", item.Artist,
+		"title", item.Title,
+		"download_url", item.DownloadURL,
+	)
+
+	observer := c.observer()
+	observer.ItemStarted(item)
+
+	result := ItemResult{Item: item}
+	fd, n, attempts, err := c.downloadFile(ctx, &item, downloadDir)
+	result.Bytes = n
+	result.Attempts = attempts
+	if err != nil {
+		Logger.Error("Could not download item",
+			"download_url", item.DownloadURL,
+			"attempts", len(attempts),
+			"error", err,
+		)
+		result.Err = err
+		observer.ItemFailed(result)
+		return result
+	}
+	defer fd.Close()
+	result.Path = fd.Name()
+	Logger.Debug("File downloaded", "file_path", fd.Name())
+
+	if !c.SkipTags {
+		Logger.Debug("Updating mp3 tags", "file_path", fd.Name())
+		err = tags.WriteMP3Tags(fd, c.itemTags(ctx, item, artworkURL))
+		if err != nil {
+			Logger.Error("Could not update mp3 tags", "file_path", fd.Name())
+		} else {
+			Logger.Debug("File mp3 tag updated", "file_path", fd.Name())
+			observer.ItemTagged(item, fd.Name())
+		}
+	}
+
+	Logger.Info("Item complete",
+		"artist", item.Artist,
+		"title", item.Title,
+		"file_path", fd.Name(),
+	)
+	observer.ItemDone(result)
+	return result
+}
+
+// DownloadAlbum downloads every item of album into downloadDir concurrently, at most
+// Concurrency at a time, and returns one result per item, in album order.
+func (c *Client) DownloadAlbum(ctx context.Context, album *Album, downloadDir string) []ItemResult {
+	if c.Enricher != nil {
+		c.Enricher.Enrich(ctx, album)
+	}
+	cover := album.CoverURL()
+	if !c.SkipArtwork && cover != "" {
+		path, err := c.SaveArtwork(ctx, cover, downloadDir)
+		if err != nil {
+			Logger.Warn("Unable to save album artwork",
+				"artwork_url", cover,
+				"error", err,
+			)
+		} else {
+			Logger.Debug("Album artwork saved", "file_path", path)
+		}
+	}
+	results := make([]ItemResult, len(album.Items))
+
+	var slots chan struct{}
+	if c.Concurrency > 0 {
+		slots = make(chan struct{}, c.Concurrency)
+	}
+
+	wg := &sync.WaitGroup{}
+	wg.Add(len(album.Items))
+	for i, item := range album.Items {
+		item.Index = i + 1
+		go func(i int, item AlbumItem) {
+			defer wg.Done()
+			if slots != nil {
+				slots <- struct{}{}
+				defer func() { <-slots }()
+			}
+			artworkURL := item.ArtworkURL()
+			if artworkURL == "" {
+				artworkURL = cover
+			}
+			results[i] = c.downloadItem(ctx, item, downloadDir, artworkURL)
+		}(i, item)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// TagItem rewrites the ID3 tags of item's previously downloaded file in downloadDir,
+// embedding the cover at artworkURL, and returns its path.
+func (c *Client) TagItem(ctx context.Context, item AlbumItem, downloadDir, artworkURL string) (string, error) {
+	path := filepath.Join(downloadDir, item.Name())
+	fd, err := os.Open(path)
+	if err != nil {
+		return path, err
+	}
+	defer fd.Close()
+	return path, tags.WriteMP3Tags(fd, c.itemTags(ctx, item, artworkURL))
+}
+
+// itemTags returns the tags of item along with the cover at artworkURL. Covers which
+// cannot be fetched are logged and left out rather than failing the item.
+func (c *Client) itemTags(ctx context.Context, item AlbumItem, artworkURL string) tags.Metadata {
+	meta := item.TagMetadata()
+	if c.SkipArtwork || artworkURL == "" {
+		return meta
+	}
+
+	artwork, err := c.Artwork(ctx, artworkURL)
+	if err != nil {
+		Logger.Warn("Unable to fetch item artwork",
+			"artwork_url", artworkURL,
+			"error", err,
+		)
+		return meta
+	}
+	meta.Artwork = artwork
+	return meta
+}
+
+// DownloadLyrics saves the lyrics of item into downloadDir as LyricsName and returns
+// the file's path. It fails with ErrNoLyrics when the item has none.
+func (c *Client) DownloadLyrics(ctx context.Context, item AlbumItem, downloadDir string) (string, error) {
+	if item.LyricURL == "" {
+		return "", ErrNoLyrics
+	}
+
+	var lyrics []byte
+	_, err := c.Fetch(ctx, item.LyricURL, func(response *http.Response) error {
+		var err error
+		lyrics, err = ioutil.ReadAll(response.Body)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.TrimSpace(lyrics)) == 0 {
+		return "", ErrNoLyrics
+	}
+
+	os.Mkdir(downloadDir, os.ModePerm)
+	path := filepath.Join(downloadDir, item.LyricsName())
+	return path, ioutil.WriteFile(path, lyrics, 0644)
+}
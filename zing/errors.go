@@ -0,0 +1,147 @@
+package zing
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Taik/zing-mp3/zing/api"
+)
+
+// Errors for tracks which exist but cannot be downloaded with the current session.
+var (
+	ErrVIPOnly      = errors.New("track is only available to VIP accounts")
+	ErrRegionLocked = errors.New("track is not available in this region")
+	ErrRemoved      = errors.New("track has been removed")
+)
+
+// unavailable maps the ways Zing and its API refuse a track onto ErrVIPOnly,
+// ErrRegionLocked and ErrRemoved. Other errors are returned unchanged.
+func unavailable(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case api.Is(err, api.ErrVIPOnly):
+		return ErrVIPOnly
+	case api.Is(err, api.ErrRegionBlocked):
+		return ErrRegionLocked
+	case api.Is(err, api.ErrRemoved), api.Is(err, api.ErrNotFound):
+		return ErrRemoved
+	}
+
+	if statusErr, ok := err.(*StatusError); ok {
+		switch statusErr.StatusCode {
+		case http.StatusUnavailableForLegalReasons:
+			return ErrRegionLocked
+		case http.StatusGone:
+			return ErrRemoved
+		}
+	}
+	return err
+}
+
+// playableItems drops the items the player gave no source, which is how it hides VIP only,
+// region locked and removed tracks. If none are left, it fails with the reason for the first.
+func (c *Client) playableItems(ctx context.Context, items []AlbumItem) ([]AlbumItem, error) {
+	playable := items[:0]
+	var firstErr error
+	for _, item := range items {
+		if strings.TrimSpace(item.DownloadURL) != "" {
+			playable = append(playable, item)
+			continue
+		}
+
+		err := c.missingSource(ctx, item)
+		Logger.Warn("Skipping song without a source",
+			"item_url", item.ItemURL,
+			"title", item.Title,
+			"error", err,
+		)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if len(playable) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return playable, nil
+}
+
+// missingSource returns why the player gave item no source. The JSON API tells region
+// locked and removed tracks apart; otherwise the track is taken to be VIP only.
+func (c *Client) missingSource(ctx context.Context, item AlbumItem) error {
+	id := idFromURL(item.ItemURL)
+	if c.API == nil || id == "" {
+		return ErrVIPOnly
+	}
+	_, err := c.API.Streaming(ctx, id)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	switch err = unavailable(err); err {
+	case ErrRegionLocked, ErrRemoved:
+		return err
+	}
+	return ErrVIPOnly
+}
+
+// StatusError is returned when Zing or its CDN answers with an unexpected HTTP status.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	// RetryAfter is the delay requested by the server's Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d from %s", e.StatusCode, e.URL)
+}
+
+// ErrorKind classifies an upstream error into a short, stable label such as
+// "timeout", "dns", "connection", "http_5xx" or "decode", suitable for metrics.
+func ErrorKind(err error) string {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	switch err {
+	case ErrCircuitOpen:
+		return "circuit_open"
+	case ErrVIPOnly:
+		return "vip_only"
+	case ErrRegionLocked:
+		return "region_locked"
+	case ErrRemoved:
+		return "removed"
+	}
+
+	switch e := err.(type) {
+	case nil:
+		return ""
+	case *StatusError:
+		return fmt.Sprintf("http_%dxx", e.StatusCode/100)
+	case *net.DNSError:
+		return "dns"
+	case *xml.SyntaxError:
+		return "decode"
+	case net.Error:
+		if e.Timeout() {
+			return "timeout"
+		}
+		return "connection"
+	}
+
+	switch err {
+	case errNoPlayerFound:
+		return "no_player"
+	case errInvalidURL:
+		return "invalid_url"
+	}
+	return "other"
+}
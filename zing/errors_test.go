@@ -0,0 +1,96 @@
+package zing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Taik/zing-mp3/zing/api"
+)
+
+// playerServer serves an album page whose player lists the given items, and the JSON
+// API's streaming endpoint answering with the error code of each song ID in codes.
+func playerServer(t *testing.T, items string, codes map[string]int) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+		case "/album/Lac-Troi-Single-Son-Tung-M-TP/ZOAE6CUW.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprintf(w, `<html><body><div id="html5player" data-xml="%s/xml/album/ZOAE6CUW"></div></body></html>`, srv.URL)
+		case "/xml/album/ZOAE6CUW":
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><data>%s</data>`, items)
+		case "/api/v2/song/get/streaming":
+			code, ok := codes[r.URL.Query().Get("id")]
+			if !ok {
+				t.Errorf("unexpected streaming request for %s", r.URL.Query().Get("id"))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"err":%d,"msg":"Error","data":{}}`, code)
+		default:
+			t.Errorf("unexpected request for %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	return srv
+}
+
+func playerItem(id, source string) string {
+	return fmt.Sprintf(`<item type="mp3"><title>Song %[1]s</title><performer>Artist</performer>
+		<link>/bai-hat/Song-%[1]s/%[1]s.html</link><source><![CDATA[%[2]s]]></source></item>`, id, source)
+}
+
+func parsePlayer(t *testing.T, srv *httptest.Server, withAPI bool) (*Album, error) {
+	client := testClient(testPolicy())
+	if withAPI {
+		client.API = api.NewClient("key", "secret", "1.0.0")
+		client.API.BaseURL = srv.URL
+	}
+	return client.ParseAlbum(context.Background(), srv.URL+"/album/Lac-Troi-Single-Son-Tung-M-TP/ZOAE6CUW.html")
+}
+
+func TestScrapedEmptySourceErrors(t *testing.T) {
+	cases := []struct {
+		code int
+		want error
+	}{
+		{-1150, ErrVIPOnly},
+		{-1110, ErrRegionLocked},
+		{-1050, ErrRemoved},
+		{-1023, ErrRemoved},
+		{-1, ErrVIPOnly},
+	}
+	for _, c := range cases {
+		srv := playerServer(t, playerItem("ZW9DBD6O", "")+playerItem("ZW9DCE0A", " "), map[string]int{"ZW9DBD6O": c.code, "ZW9DCE0A": -1150})
+		album, err := parsePlayer(t, srv, true)
+		srv.Close()
+		if err != c.want {
+			t.Errorf("API code %d: album %v, error %v, want %v", c.code, album, err, c.want)
+		}
+	}
+}
+
+func TestScrapedEmptySourceWithoutAPI(t *testing.T) {
+	srv := playerServer(t, playerItem("ZW9DBD6O", ""), nil)
+	defer srv.Close()
+
+	if _, err := parsePlayer(t, srv, false); err != ErrVIPOnly {
+		t.Errorf("error %v, want %v", err, ErrVIPOnly)
+	}
+}
+
+func TestScrapedEmptySourceSkipped(t *testing.T) {
+	srv := playerServer(t, playerItem("ZW9DBD6O", "http://example.com/ZW9DBD6O.mp3")+playerItem("ZW9DCE0A", ""), map[string]int{"ZW9DCE0A": -1110})
+	defer srv.Close()
+
+	album, err := parsePlayer(t, srv, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(album.Items) != 1 || album.Items[0].Title != "Song ZW9DBD6O" {
+		t.Errorf("items %+v, want only the one with a source", album.Items)
+	}
+}
@@ -0,0 +1,100 @@
+package zing
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/Taik/zing-mp3/zing/api"
+)
+
+// canFallBack reports whether a failed scrape of an album is worth retrying through the JSON API.
+// Tracks the scrape found unavailable are unavailable there too.
+func (c *Client) canFallBack(ctx context.Context, err error) bool {
+	switch err {
+	case errInvalidURL, ErrCircuitOpen, ErrVIPOnly, ErrRegionLocked, ErrRemoved:
+		return false
+	}
+	return c.API != nil && ctx.Err() == nil
+}
+
+// parseAlbumAPI builds the album at zingURL from the JSON API instead of the page's player.
+// Song pages become single item albums.
+func (c *Client) parseAlbumAPI(ctx context.Context, zingURL string) (*Album, error) {
+	u, err := url.Parse(strings.TrimSpace(zingURL))
+	if err != nil {
+		return nil, errInvalidURL
+	}
+	id := idFromURL(zingURL)
+	if id == "" {
+		return nil, errInvalidURL
+	}
+
+	album := &Album{}
+	var songs []api.Song
+	if strings.HasPrefix(u.Path, "/bai-hat/") {
+		song, err := c.API.Song(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		songs = []api.Song{*song}
+		album.ArtworkURL = song.Thumbnail
+	} else {
+		playlist, err := c.API.Playlist(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		songs = playlist.Songs.Items
+		album.ArtworkURL = playlist.Thumbnail
+	}
+
+	var firstErr error
+	for _, song := range songs {
+		streams, err := c.API.Streaming(ctx, song.ID)
+		if err == nil && streams[PlayerQuality] == "" {
+			err = ErrVIPOnly
+		}
+		if err != nil {
+			err = unavailable(err)
+			Logger.Warn("Skipping song without a stream",
+				"song_id", song.ID,
+				"title", song.Title,
+				"error", err,
+			)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		item := AlbumItem{
+			Title:       song.Title,
+			Artist:      song.ArtistsNames,
+			ItemURL:     c.apiLink(song.Link),
+			DownloadURL: streams[PlayerQuality],
+		}
+		if song.HasLyric {
+			if lyrics, err := c.API.Lyrics(ctx, song.ID); err == nil {
+				item.LyricURL = lyrics.File
+			}
+		}
+		album.Items = append(album.Items, item)
+	}
+	if len(album.Items) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return album, nil
+}
+
+// apiLink resolves a link returned by the API against the API's site.
+func (c *Client) apiLink(link string) string {
+	base, err := url.Parse(c.API.BaseURL)
+	if err != nil {
+		return link
+	}
+	u, err := base.Parse(link)
+	if err != nil {
+		return link
+	}
+	return u.String()
+}
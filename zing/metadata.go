@@ -0,0 +1,270 @@
+package zing
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/Taik/zing-mp3/tags"
+)
+
+// Metadata is what is known about an item beyond the player XML's title and performer.
+type Metadata struct {
+	Album      string        `json:"album,omitempty"`
+	Genre      string        `json:"genre,omitempty"`
+	Year       string        `json:"year,omitempty"`
+	Composer   string        `json:"composer,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	ArtworkURL string        `json:"artwork_url,omitempty"`
+}
+
+// TagMetadata returns the tags written to the item's file, including its Meta when enriched.
+func (i *AlbumItem) TagMetadata() tags.Metadata {
+	meta := tags.Metadata{
+		Artist: strings.TrimSpace(i.Artist),
+		Title:  strings.TrimSpace(i.Title),
+	}
+	if i.Meta != nil {
+		meta.Album = i.Meta.Album
+		meta.Genre = i.Meta.Genre
+		meta.Year = i.Meta.Year
+		meta.Composer = i.Meta.Composer
+		meta.Duration = i.Meta.Duration
+	}
+	return meta
+}
+
+var isoDuration = regexp.MustCompile(`^PT(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?$`)
+
+// parseISODuration reads durations such as PT4M13S, as used by schema.org markup.
+func parseISODuration(s string) time.Duration {
+	m := isoDuration.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil {
+		return 0
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		if n, err := strconv.Atoi(m[i+1]); err == nil {
+			d += time.Duration(n) * unit
+		}
+	}
+	return d
+}
+
+// ItemMetadata looks up the extra metadata of item, from the JSON API when the client
+// has one and otherwise from the schema.org markup of the item's song page.
+func (c *Client) ItemMetadata(ctx context.Context, item AlbumItem) (*Metadata, error) {
+	if c.API != nil && item.ID() != "" {
+		meta, err := c.apiMetadata(ctx, item)
+		if err == nil {
+			return meta, nil
+		}
+		Logger.Debug("Falling back to scraping item metadata", "item_url", item.ItemURL, "error", err)
+	}
+	return c.scrapeMetadata(ctx, item.ItemURL)
+}
+
+func (c *Client) apiMetadata(ctx context.Context, item AlbumItem) (*Metadata, error) {
+	song, err := c.API.Song(ctx, item.ID())
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &Metadata{
+		Duration:   time.Duration(song.Duration) * time.Second,
+		ArtworkURL: song.Thumbnail,
+	}
+	if song.Album != nil {
+		meta.Album = song.Album.Title
+	}
+	if song.ReleaseDate > 0 {
+		meta.Year = strconv.Itoa(time.Unix(song.ReleaseDate, 0).Year())
+	}
+	composers := []string{}
+	for _, composer := range song.Composers {
+		composers = append(composers, composer.Name)
+	}
+	meta.Composer = strings.Join(composers, ", ")
+
+	genres := []string{}
+	for _, genre := range song.Genres {
+		name := genre.Title
+		if name == "" {
+			name = genre.Name
+		}
+		if name != "" {
+			genres = append(genres, name)
+		}
+	}
+	meta.Genre = strings.Join(genres, ", ")
+	if meta.Genre == "" && len(song.GenreIDs) > 0 {
+		// The IDs alone are opaque; the song page names them.
+		scraped, err := c.scrapeMetadata(ctx, item.ItemURL)
+		if err != nil {
+			Logger.Debug("Unable to scrape item genre", "item_url", item.ItemURL, "error", err)
+		} else {
+			meta.Genre = scraped.Genre
+		}
+	}
+	return meta, nil
+}
+
+func (c *Client) scrapeMetadata(ctx context.Context, itemURL string) (*Metadata, error) {
+	if itemURL == "" {
+		return nil, errInvalidURL
+	}
+
+	meta := &Metadata{}
+	_, err := c.Fetch(ctx, itemURL, func(response *http.Response) error {
+		doc, err := goquery.NewDocumentFromResponse(response)
+		if err != nil {
+			return err
+		}
+
+		*meta = Metadata{}
+		doc.Find("[itemprop]").Each(func(_ int, s *goquery.Selection) {
+			value, ok := s.Attr("content")
+			if !ok {
+				value = s.Text()
+				// Nested items such as inAlbum carry their title in a name property.
+				if name := s.Find("[itemprop=name]").First(); name.Length() > 0 {
+					value = name.AttrOr("content", name.Text())
+				}
+			}
+			value = strings.TrimSpace(value)
+			if value == "" {
+				return
+			}
+
+			switch prop, _ := s.Attr("itemprop"); prop {
+			case "inAlbum":
+				meta.Album = value
+			case "genre":
+				if meta.Genre == "" {
+					meta.Genre = value
+				} else {
+					meta.Genre += ", " + value
+				}
+			case "datePublished", "dateCreated":
+				if len(value) >= 4 && meta.Year == "" {
+					meta.Year = value[:4]
+				}
+			case "composer":
+				meta.Composer = value
+			case "duration":
+				meta.Duration = parseISODuration(value)
+			case "image", "thumbnailUrl":
+				if meta.ArtworkURL == "" {
+					meta.ArtworkURL = value
+				}
+			}
+		})
+		if meta.ArtworkURL == "" {
+			meta.ArtworkURL, _ = doc.Find(`meta[property="og:image"]`).Attr("content")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// DefaultEnrichConcurrency is the number of song pages an Enricher fetches at once by default.
+const DefaultEnrichConcurrency = 4
+
+// maxEnrichCache bounds the number of items an Enricher remembers.
+const maxEnrichCache = 4096
+
+// Enricher fills in the Meta of album items, remembering what it looked up so items
+// shared between albums or runs of a long lived process are only fetched once.
+type Enricher struct {
+	// Client defaults to DefaultClient.
+	Client *Client
+	// Concurrency defaults to DefaultEnrichConcurrency.
+	Concurrency int
+
+	mu    sync.Mutex
+	cache map[string]*Metadata
+}
+
+// NewEnricher returns an Enricher fetching with client.
+func NewEnricher(client *Client) *Enricher {
+	return &Enricher{
+		Client:      client,
+		Concurrency: DefaultEnrichConcurrency,
+	}
+}
+
+func (e *Enricher) cached(itemURL string) (*Metadata, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	meta, ok := e.cache[itemURL]
+	return meta, ok
+}
+
+func (e *Enricher) store(itemURL string, meta *Metadata) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cache == nil {
+		e.cache = make(map[string]*Metadata)
+	}
+	if len(e.cache) >= maxEnrichCache {
+		for key := range e.cache {
+			delete(e.cache, key)
+			break
+		}
+	}
+	e.cache[itemURL] = meta
+}
+
+// Enrich looks up the metadata of every item of album which has none yet. Items whose
+// lookup fails are logged and left as they were, so they are still tagged with what
+// the player XML provides.
+func (e *Enricher) Enrich(ctx context.Context, album *Album) {
+	client := e.Client
+	if client == nil {
+		client = DefaultClient
+	}
+	concurrency := e.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultEnrichConcurrency
+	}
+
+	slots := make(chan struct{}, concurrency)
+	wg := &sync.WaitGroup{}
+	for i := range album.Items {
+		item := &album.Items[i]
+		if item.Meta != nil || item.ItemURL == "" {
+			continue
+		}
+		if meta, ok := e.cached(item.ItemURL); ok {
+			item.Meta = meta
+			continue
+		}
+
+		wg.Add(1)
+		go func(item *AlbumItem) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			meta, err := client.ItemMetadata(ctx, *item)
+			if err != nil {
+				Logger.Warn("Unable to enrich item metadata",
+					"item_url", item.ItemURL,
+					"error", err,
+				)
+				return
+			}
+			e.store(item.ItemURL, meta)
+			item.Meta = meta
+		}(item)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,82 @@
+package zing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Taik/zing-mp3/zing/api"
+)
+
+const songPage = `<html><body itemscope itemtype="http://schema.org/MusicRecording">
+<h1 itemprop="name">Lạc Trôi</h1>
+<a itemprop="genre" href="/the-loai-bai-hat/Viet-Nam/IWZ9Z08I.html">Việt Nam</a>,
+<a itemprop="genre" href="/the-loai-bai-hat/Pop/IWZ97FCD.html">Pop</a>
+</body></html>`
+
+// metadataServer serves a song from the JSON API, with genres as given, and its page.
+func metadataServer(t *testing.T, genres string) (*httptest.Server, *int) {
+	pageHits := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+		case "/api/v2/page/get/song":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"err":0,"msg":"Success","data":{"encodeId":"ZW9DBD6O","title":"Lạc Trôi","duration":233,
+				"album":{"encodeId":"ZOAE6CUW","title":"Lạc Trôi (Single)"},"genreIds":["IWZ9Z08I","IWZ97FCD"]%s}}`, genres)
+		case "/bai-hat/Lac-Troi-Son-Tung-M-TP/ZW9DBD6O.html":
+			pageHits++
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, songPage)
+		default:
+			t.Errorf("unexpected request for %s", r.URL)
+			http.NotFound(w, r)
+		}
+	})), &pageHits
+}
+
+func metadataClient(srv *httptest.Server) (*Client, AlbumItem) {
+	client := testClient(testPolicy())
+	client.API = api.NewClient("key", "secret", "1.0.0")
+	client.API.BaseURL = srv.URL
+	return client, AlbumItem{ItemURL: srv.URL + "/bai-hat/Lac-Troi-Son-Tung-M-TP/ZW9DBD6O.html"}
+}
+
+func TestAPIMetadataGenres(t *testing.T) {
+	srv, pageHits := metadataServer(t, `,"genres":[{"id":"IWZ9Z08I","name":"Việt Nam","title":"Việt Nam"},{"id":"IWZ97FCD","name":"Pop","title":""}]`)
+	defer srv.Close()
+	client, item := metadataClient(srv)
+
+	meta, err := client.ItemMetadata(context.Background(), item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Genre != "Việt Nam, Pop" || meta.Album != "Lạc Trôi (Single)" {
+		t.Errorf("genre %q, album %q; want %q, %q", meta.Genre, meta.Album, "Việt Nam, Pop", "Lạc Trôi (Single)")
+	}
+	if *pageHits != 0 {
+		t.Errorf("the song page was fetched %d times, want none", *pageHits)
+	}
+}
+
+func TestAPIMetadataGenreIDsOnly(t *testing.T) {
+	srv, pageHits := metadataServer(t, "")
+	defer srv.Close()
+	client, item := metadataClient(srv)
+
+	meta, err := client.ItemMetadata(context.Background(), item)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Genre != "Việt Nam, Pop" {
+		t.Errorf("genre %q, want the names scraped from the song page", meta.Genre)
+	}
+	if meta.Album != "Lạc Trôi (Single)" {
+		t.Errorf("album %q, want the one from the API", meta.Album)
+	}
+	if *pageHits != 1 {
+		t.Errorf("the song page was fetched %d times, want once", *pageHits)
+	}
+}
@@ -0,0 +1,35 @@
+package zing
+
+import "time"
+
+// Metrics receives instrumentation from the package so callers can feed it into
+// the metrics backend of their choice. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveParse records how long parsing an album took and whether it failed.
+	ObserveParse(duration time.Duration, err error)
+	// ObserveDownload records a finished item download with the number of bytes received.
+	ObserveDownload(duration time.Duration, bytes int64, err error)
+	// UpstreamError records a failed request to Zing or its CDN, labelled by ErrorKind.
+	UpstreamError(kind string)
+}
+
+// DefaultMetrics receives the package's instrumentation. It discards everything by default.
+var DefaultMetrics Metrics = NopMetrics{}
+
+// NopMetrics is a Metrics implementation which discards everything.
+type NopMetrics struct{}
+
+// ObserveParse implements Metrics.
+func (NopMetrics) ObserveParse(time.Duration, error) {}
+
+// ObserveDownload implements Metrics.
+func (NopMetrics) ObserveDownload(time.Duration, int64, error) {}
+
+// UpstreamError implements Metrics.
+func (NopMetrics) UpstreamError(string) {}
+
+// upstreamError reports err to DefaultMetrics and returns it unchanged.
+func upstreamError(err error) error {
+	DefaultMetrics.UpstreamError(ErrorKind(err))
+	return err
+}
@@ -1,18 +1,17 @@
 package zing
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
+	"path"
 	"strings"
-	"sync"
+	"text/template"
 
-	"github.com/PuerkitoBio/goquery"
-	"github.com/Taik/zing-mp3/tags"
 	"gopkg.in/inconshreveable/log15.v2"
 )
 
@@ -22,6 +21,9 @@ var (
 
 	errNoPlayerFound = errors.New("no HTML5 player instance found")
 	errInvalidURL    = errors.New("invalid url")
+
+	// ErrNoLyrics is returned for items which have no lyrics.
+	ErrNoLyrics = errors.New("item has no lyrics")
 )
 
 func init() {
@@ -29,78 +31,135 @@ func init() {
 	Logger.SetHandler(log15.DiscardHandler())
 }
 
+// PlayerQuality is the bitrate, in kbps, of the sources listed in the player XML.
+const PlayerQuality = "128"
+
 // AlbumItem represents each item in Album.
 type AlbumItem struct {
-	Title       string `xml:"title"`
-	Artist      string `xml:"performer"`
-	ItemURL     string `xml:"link"`
-	DownloadURL string `xml:"source"`
-	LyricURL    string `xml:"lyric"`
+	Title       string `xml:"title" json:"title"`
+	Artist      string `xml:"performer" json:"artist"`
+	ItemURL     string `xml:"link" json:"item_url"`
+	DownloadURL string `xml:"source" json:"download_url"`
+	LyricURL    string `xml:"lyric" json:"lyric_url"`
+	// Meta is filled in by an Enricher; it is nil until then.
+	Meta *Metadata `xml:"-" json:"metadata,omitempty"`
+	// Index is the item's position in the album given to DownloadAlbum, from 1, so
+	// observers can tell items apart. It is zero for items downloaded on their own.
+	Index int `xml:"-" json:"index,omitempty"`
 }
 
 // Album represents a Zing MP3 player source.
 type Album struct {
-	XMLName xml.Name    `xml:"data"`
-	Items   []AlbumItem `xml:"item"`
+	XMLName xml.Name    `xml:"data" json:"-"`
+	Items   []AlbumItem `xml:"item" json:"items"`
+	// ArtworkURL is the album's cover, taken from its page rather than the player XML.
+	ArtworkURL string `xml:"-" json:"artwork_url,omitempty"`
 }
 
-// Name returns a filename generated by concatening Artist and Title together.
-func (i *AlbumItem) Name() string {
-	return fmt.Sprintf("%s - %s.mp3",
-		strings.TrimSpace(i.Artist),
-		strings.TrimSpace(i.Title),
-	)
-}
+// DefaultNameTemplate names files after the artist and title of their item.
+const DefaultNameTemplate = "{{.Artist}} - {{.Title}}"
 
-// ParseAlbumData parses a zing MP3 URL and returns a Album associated with the current player on the page.
-func ParseAlbumData(zingURL string) (*Album, error) {
-	if zingURL == "" {
-		Logger.Error("Invalid album data URL",
-			"zing_url", zingURL,
-		)
-		return nil, errInvalidURL
-	}
-	Logger.Debug("Parsing for album data URL",
-		"zing_url", zingURL,
-	)
+var nameTemplate = template.Must(template.New("name").Parse(DefaultNameTemplate))
 
-	doc, err := goquery.NewDocument(zingURL)
+// nameFields are the fields available to name templates.
+type nameFields struct {
+	Artist, Title, ID string
+	// Album, Genre and Year are empty unless the item has been enriched.
+	Album, Genre, Year string
+}
+
+// SetNameTemplate sets the text/template Name uses, e.g. "{{.Artist}} - {{.Album}} - {{.Title}}".
+// It may use .Artist, .Title and .ID, and .Album, .Genre and .Year of enriched items.
+func SetNameTemplate(text string) error {
+	t, err := template.New("name").Parse(text)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := t.Execute(&bytes.Buffer{}, nameFields{}); err != nil {
+		return err
 	}
+	nameTemplate = t
+	return nil
+}
 
-	dataXMLURL, found := doc.Find("div#html5player").Attr("data-xml")
-	if found == false {
-		return nil, errNoPlayerFound
+// Name returns the filename of the item, made from the name template and ".mp3".
+func (i *AlbumItem) Name() string {
+	fields := nameFields{
+		Artist: strings.TrimSpace(i.Artist),
+		Title:  strings.TrimSpace(i.Title),
+		ID:     i.ID(),
+	}
+	if i.Meta != nil {
+		fields.Album = strings.TrimSpace(i.Meta.Album)
+		fields.Genre = strings.TrimSpace(i.Meta.Genre)
+		fields.Year = strings.TrimSpace(i.Meta.Year)
 	}
 
-	Logger.Debug("Found zing album data URL",
-		"album_data_xml", dataXMLURL,
-	)
-	response, err := http.Get(dataXMLURL)
-	if err != nil {
-		return nil, err
+	name := &bytes.Buffer{}
+	if err := nameTemplate.Execute(name, fields); err != nil {
+		return fmt.Sprintf("%s - %s.mp3", fields.Artist, fields.Title)
 	}
-	defer response.Body.Close()
+	return strings.TrimSpace(name.String()) + ".mp3"
+}
+
+// LyricsName returns the filename used for the item's lyrics, next to its Name.
+func (i *AlbumItem) LyricsName() string {
+	return strings.TrimSuffix(i.Name(), ".mp3") + ".lrc"
+}
 
-	album := &Album{}
-	err = xml.NewDecoder(response.Body).Decode(album)
+// ID returns the Zing track ID embedded in ItemURL, e.g. "ZW6ABCDE" for
+// http://mp3.zing.vn/bai-hat/Title-Artist/ZW6ABCDE.html. It is empty when ItemURL has no ID.
+func (i *AlbumItem) ID() string {
+	return idFromURL(i.ItemURL)
+}
+
+// idFromURL returns the last path segment of a Zing URL without its extension.
+func idFromURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
 	if err != nil {
-		return nil, err
+		return ""
 	}
+	id := strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))
+	if id == "/" || id == "." {
+		return ""
+	}
+	return id
+}
 
-	return album, nil
+// ParseAlbumData parses a zing MP3 URL and returns a Album associated with the current player on the page.
+func ParseAlbumData(zingURL string) (*Album, error) {
+	return DefaultClient.ParseAlbum(context.Background(), zingURL)
 }
 
 // DownloadAlbum initializes
 func DownloadAlbum(zingURL, downloadDir string) error {
-	album, err := ParseAlbumData(zingURL)
+	return DownloadAlbumSelection(zingURL, downloadDir, Selection{})
+}
+
+// DownloadAlbumSelection downloads the items of the album at zingURL picked by sel into downloadDir.
+func DownloadAlbumSelection(zingURL, downloadDir string, sel Selection) error {
+	_, err := DownloadAlbumResults(context.Background(), zingURL, downloadDir, sel)
+	return err
+}
+
+// DownloadAlbumResults is like DownloadAlbumSelection but also returns the outcome of every item.
+func DownloadAlbumResults(ctx context.Context, zingURL, downloadDir string, sel Selection) ([]ItemResult, error) {
+	album, err := DefaultParser.Parse(ctx, zingURL)
 	if err != nil {
 		Logger.Error("Unable to parse album data",
 			"album_url", zingURL,
 			"error", err,
 		)
-		return nil
+		return nil, err
+	}
+
+	album, err = album.Select(sel)
+	if err != nil {
+		Logger.Error("Unable to select album items",
+			"album_url", zingURL,
+			"error", err,
+		)
+		return nil, err
 	}
 
 	Logger.Debug("Found items to download",
@@ -108,60 +167,17 @@ func DownloadAlbum(zingURL, downloadDir string) error {
 		"album_url", zingURL,
 	)
 
-	wg := &sync.WaitGroup{}
-	wg.Add(len(album.Items))
-
-	for _, v := range album.Items {
-		go func(item AlbumItem) {
-			defer wg.Done()
-			Logger.Info("Processing item",
-				"artist", item.Artist,
-				"title", item.Title,
-				"download_url", item.DownloadURL,
-			)
-
-			Logger.Debug("Downloading item", "download_url", item.DownloadURL)
-			fd, err := DownloadAlbumItem(&item, downloadDir)
-			if err != nil {
-				Logger.Error("Could not download item", "error", err)
-			} else {
-				Logger.Debug("File downloaded", "file_path", fd.Name())
-			}
-
-			Logger.Debug("Updating mp3 tags", "file_path", fd.Name())
-			err = tags.UpdateMP3Tags(fd, item.Artist, item.Title)
-			if err != nil {
-				Logger.Error("Could not update mp3 tags", "file_path", fd.Name())
-			} else {
-				Logger.Debug("File mp3 tag updated", "file_path", fd.Name())
-			}
-
-			Logger.Info("Item complete",
-				"artist", item.Artist,
-				"title", item.Title,
-				"file_path", fd.Name(),
-			)
-		}(v)
-	}
-
-	wg.Wait()
-	return nil
+	return DefaultClient.DownloadAlbum(ctx, album, downloadDir), nil
 }
 
 // DownloadAlbumItem fetches the song from DownloadURL and returns an os.File which represents the file on-disk.
 func DownloadAlbumItem(item *AlbumItem, downloadDir string) (*os.File, error) {
-	os.Mkdir(downloadDir, os.ModePerm)
-
-	response, err := http.Get(item.DownloadURL)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
+	fd, _, _, err := DefaultClient.downloadFile(context.Background(), item, downloadDir)
+	return fd, err
+}
 
-	fd, err := os.Create(filepath.Join(downloadDir, item.Name()))
-	if err != nil {
-		return nil, err
-	}
-	io.Copy(fd, response.Body)
-	return fd, nil
+// TagItem rewrites the ID3 tags of item's previously downloaded file in downloadDir
+// and returns its path.
+func TagItem(item AlbumItem, downloadDir string) (string, error) {
+	return DefaultClient.TagItem(context.Background(), item, downloadDir, item.ArtworkURL())
 }
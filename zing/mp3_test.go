@@ -0,0 +1,36 @@
+package zing
+
+import "testing"
+
+func TestNameTemplate(t *testing.T) {
+	defer SetNameTemplate(DefaultNameTemplate)
+
+	item := AlbumItem{
+		Title:   " Lạc Trôi ",
+		Artist:  "Sơn Tùng M-TP",
+		ItemURL: "http://mp3.zing.vn/bai-hat/Lac-Troi-Son-Tung-M-TP/ZW9DBD6O.html",
+	}
+	if got, want := item.Name(), "Sơn Tùng M-TP - Lạc Trôi.mp3"; got != want {
+		t.Errorf("default Name() = %q, want %q", got, want)
+	}
+	if got, want := item.LyricsName(), "Sơn Tùng M-TP - Lạc Trôi.lrc"; got != want {
+		t.Errorf("LyricsName() = %q, want %q", got, want)
+	}
+
+	if err := SetNameTemplate("{{.Year}} {{.Album}} - {{.Title}} [{{.ID}}]"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := item.Name(), "- Lạc Trôi [ZW9DBD6O].mp3"; got != want {
+		t.Errorf("Name() before enrichment = %q, want %q", got, want)
+	}
+	item.Meta = &Metadata{Album: "Lạc Trôi (Single)", Year: "2017"}
+	if got, want := item.Name(), "2017 Lạc Trôi (Single) - Lạc Trôi [ZW9DBD6O].mp3"; got != want {
+		t.Errorf("Name() = %q, want %q", got, want)
+	}
+
+	for _, bad := range []string{"{{.Artist", "{{.Label}}"} {
+		if err := SetNameTemplate(bad); err == nil {
+			t.Errorf("SetNameTemplate(%q) succeeded", bad)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package zing
+
+import "io"
+
+// Observer receives typed events while a Client parses and downloads albums,
+// so callers can render progress or record metrics without parsing logs.
+// Methods may be called concurrently from several goroutines.
+type Observer interface {
+	// AlbumParsed is called once an album's item list is known.
+	AlbumParsed(album *Album)
+	// ItemStarted is called before an item is downloaded.
+	ItemStarted(item AlbumItem)
+	// Progress reports the bytes of item received so far in the current attempt.
+	// total is -1 when the server did not announce a length. A retried download
+	// starts again from zero.
+	Progress(item AlbumItem, bytes, total int64)
+	// ItemTagged is called once the ID3 tags of the downloaded file at path have been written.
+	ItemTagged(item AlbumItem, path string)
+	// ItemDone is called when an item has been downloaded successfully.
+	ItemDone(result ItemResult)
+	// ItemFailed is called when an item could not be downloaded; result.Err holds the reason.
+	ItemFailed(result ItemResult)
+}
+
+// NopObserver ignores every event. Embed it to implement only some of Observer's methods.
+type NopObserver struct{}
+
+// AlbumParsed implements Observer.
+func (NopObserver) AlbumParsed(album *Album) {}
+
+// ItemStarted implements Observer.
+func (NopObserver) ItemStarted(item AlbumItem) {}
+
+// Progress implements Observer.
+func (NopObserver) Progress(item AlbumItem, bytes, total int64) {}
+
+// ItemTagged implements Observer.
+func (NopObserver) ItemTagged(item AlbumItem, path string) {}
+
+// ItemDone implements Observer.
+func (NopObserver) ItemDone(result ItemResult) {}
+
+// ItemFailed implements Observer.
+func (NopObserver) ItemFailed(result ItemResult) {}
+
+// progressReader reports every read from r to an Observer.
+type progressReader struct {
+	r        io.Reader
+	item     AlbumItem
+	n, total int64
+	observer Observer
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.n += int64(n)
+		p.observer.Progress(p.item, p.n, p.total)
+	}
+	return n, err
+}
@@ -0,0 +1,102 @@
+package zing
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/Taik/zing-mp3/provider"
+)
+
+// ProviderName is the name the Zing provider is registered under.
+const ProviderName = "zing"
+
+func init() {
+	provider.Register(&Provider{})
+}
+
+// Provider resolves and searches Zing MP3 through a Client.
+type Provider struct {
+	// Client defaults to DefaultClient.
+	Client *Client
+}
+
+func (p *Provider) client() *Client {
+	if p.Client == nil {
+		return DefaultClient
+	}
+	return p.Client
+}
+
+// Name implements provider.Provider.
+func (p *Provider) Name() string {
+	return ProviderName
+}
+
+// Match implements provider.Provider.
+func (p *Provider) Match(u *url.URL) bool {
+	return provider.MatchHost(u, "zing.vn", "zingmp3.vn")
+}
+
+// Resolve implements provider.Provider.
+func (p *Provider) Resolve(ctx context.Context, rawURL string) (*provider.Collection, error) {
+	album, err := p.client().resolveAlbum(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return album.Collection(rawURL), nil
+}
+
+// Search implements provider.Provider.
+func (p *Provider) Search(ctx context.Context, query string, kind provider.SearchKind) ([]provider.SearchResult, error) {
+	return p.client().Search(ctx, query, kind)
+}
+
+// Collection converts the album found at zingURL into the provider model.
+func (a *Album) Collection(zingURL string) *provider.Collection {
+	collection := &provider.Collection{
+		Provider:   ProviderName,
+		ID:         idFromURL(zingURL),
+		URL:        zingURL,
+		ArtworkURL: a.ArtworkURL,
+		Tracks:     make([]provider.Track, len(a.Items)),
+	}
+	for i, item := range a.Items {
+		collection.Tracks[i] = provider.Track{
+			ID:        item.ID(),
+			Title:     item.Title,
+			Artist:    item.Artist,
+			URL:       item.ItemURL,
+			LyricsURL: item.LyricURL,
+			Sources: []provider.Source{{
+				URL:     item.DownloadURL,
+				Quality: PlayerQuality,
+				Format:  "mp3",
+			}},
+		}
+	}
+	return collection
+}
+
+// NewAlbum converts a collection resolved by any provider into an Album, using each
+// track's PlayerQuality source when it has one. Tracks without sources are left out.
+func NewAlbum(collection *provider.Collection) *Album {
+	album := &Album{ArtworkURL: collection.ArtworkURL}
+	for _, track := range collection.Tracks {
+		source, ok := track.Source(PlayerQuality)
+		if !ok {
+			Logger.Warn("Skipping track without sources",
+				"provider", collection.Provider,
+				"track_url", track.URL,
+			)
+			continue
+		}
+		album.Items = append(album.Items, AlbumItem{
+			Title:       track.Title,
+			Artist:      track.Artist,
+			ItemURL:     track.URL,
+			DownloadURL: source.URL,
+			LyricURL:    track.LyricsURL,
+		})
+	}
+	return album
+}
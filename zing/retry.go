@@ -0,0 +1,225 @@
+package zing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without making a request when a host has failed too often recently.
+var ErrCircuitOpen = errors.New("circuit breaker open for host")
+
+// RetryPolicy controls how upstream requests are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per request, including the first one.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; it doubles on every following one.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between attempts, including delays asked for by Retry-After.
+	MaxDelay time.Duration
+
+	// BreakerThreshold is the number of consecutive failed requests which opens a host's
+	// circuit. A request counts once however many attempts it made. Zero disables the
+	// circuit breaker.
+	BreakerThreshold int
+	// BreakerCooldown is how long an open circuit rejects requests before letting one through.
+	BreakerCooldown time.Duration
+}
+
+// DefaultRetryPolicy is used by clients created with NewClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:      4,
+	BaseDelay:        500 * time.Millisecond,
+	MaxDelay:         15 * time.Second,
+	BreakerThreshold: 8,
+	BreakerCooldown:  30 * time.Second,
+}
+
+// Attempt records a single upstream request made on behalf of an operation.
+type Attempt struct {
+	URL        string        `json:"url"`
+	Start      time.Time     `json:"start"`
+	Duration   time.Duration `json:"duration"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	// Backoff is how long the client waited after this attempt before the next one.
+	Backoff time.Duration `json:"backoff,omitempty"`
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying:
+// 5xx, 408 and 429 responses, timeouts, connection resets and truncated bodies.
+func IsRetryable(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	switch e := err.(type) {
+	case nil:
+		return false
+	case *StatusError:
+		return e.StatusCode >= 500 ||
+			e.StatusCode == http.StatusRequestTimeout ||
+			e.StatusCode == http.StatusTooManyRequests
+	case *net.DNSError:
+		return e.Temporary() || e.Timeout()
+	case net.Error:
+		return true
+	}
+
+	return err == io.ErrUnexpectedEOF
+}
+
+// backoff returns the delay before retry number n (starting at 1), using full jitter.
+func (p RetryPolicy) backoff(n int, err error) time.Duration {
+	if statusErr, ok := err.(*StatusError); ok && statusErr.RetryAfter > 0 {
+		if statusErr.RetryAfter > p.MaxDelay {
+			return p.MaxDelay
+		}
+		return statusErr.RetryAfter
+	}
+
+	ceiling := p.BaseDelay << uint(n-1)
+	if ceiling > p.MaxDelay || ceiling <= 0 {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(time.Now()); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// sleepContext waits for d or until ctx is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type hostCircuit struct {
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// breakers tracks a circuit per upstream host.
+type breakers struct {
+	mu    sync.Mutex
+	hosts map[string]*hostCircuit
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// Allow reports whether a request to host may proceed. Once the cooldown of an open circuit
+// has passed a single probe is let through, reported by probe; its outcome closes or
+// re-opens the circuit. A probe must be ended with EndProbe whatever its outcome.
+func (b *breakers) Allow(host string, policy RetryPolicy) (allowed, probe bool) {
+	if policy.BreakerThreshold <= 0 {
+		return true, false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	if !ok || c.failures < policy.BreakerThreshold {
+		return true, false
+	}
+	if c.probing || time.Now().Before(c.openUntil) {
+		return false, false
+	}
+	c.probing = true
+	return true, true
+}
+
+// Open reports whether host's circuit rejects requests, without taking the probe.
+func (b *breakers) Open(host string, policy RetryPolicy) bool {
+	if policy.BreakerThreshold <= 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c, ok := b.hosts[host]
+	return ok && c.failures >= policy.BreakerThreshold && (c.probing || time.Now().Before(c.openUntil))
+}
+
+// EndProbe lets the next probe through once a probe is over, including one which was
+// cancelled before its outcome could be recorded.
+func (b *breakers) EndProbe(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.hosts[host]; ok {
+		c.probing = false
+	}
+}
+
+// Record updates host's circuit with the outcome of a request.
+func (b *breakers) Record(host string, failed bool, policy RetryPolicy) {
+	if policy.BreakerThreshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.hosts == nil {
+		b.hosts = make(map[string]*hostCircuit)
+	}
+	c, ok := b.hosts[host]
+	if !ok {
+		c = &hostCircuit{}
+		b.hosts[host] = c
+	}
+
+	if !failed {
+		c.failures = 0
+		return
+	}
+	c.failures++
+	if c.failures >= policy.BreakerThreshold {
+		if c.failures == policy.BreakerThreshold {
+			Logger.Warn("Opening circuit breaker", "host", host)
+		}
+		c.openUntil = time.Now().Add(policy.BreakerCooldown)
+	}
+}
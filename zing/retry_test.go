@@ -0,0 +1,142 @@
+package zing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testClient(policy RetryPolicy) *Client {
+	client := NewClient()
+	client.Retry = policy
+	return client
+}
+
+func testPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:      3,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  20 * time.Millisecond,
+	}
+}
+
+func discard(*http.Response) error { return nil }
+
+func TestBreakerCountsRequestsNotAttempts(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := testClient(testPolicy())
+	attempts, err := client.Fetch(context.Background(), srv.URL, discard)
+	if err == nil || len(attempts) != 3 {
+		t.Fatalf("first request: %d attempts, error %v; want 3 failed attempts", len(attempts), err)
+	}
+
+	// One failed request is below the threshold of two, however many attempts it made.
+	attempts, err = client.Fetch(context.Background(), srv.URL, discard)
+	if err == ErrCircuitOpen || len(attempts) != 3 {
+		t.Fatalf("second request: %d attempts, error %v; want 3 failed attempts", len(attempts), err)
+	}
+
+	_, err = client.Fetch(context.Background(), srv.URL, discard)
+	if err != ErrCircuitOpen {
+		t.Fatalf("third request: error %v, want %v", err, ErrCircuitOpen)
+	}
+	if n := atomic.LoadInt32(&hits); n != 6 {
+		t.Errorf("server got %d requests, want 6", n)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	var healthy int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer srv.Close()
+
+	policy := testPolicy()
+	policy.MaxAttempts = 1
+	client := testClient(policy)
+	for i := 0; i < policy.BreakerThreshold; i++ {
+		client.Fetch(context.Background(), srv.URL, discard)
+	}
+	if _, err := client.Fetch(context.Background(), srv.URL, discard); err != ErrCircuitOpen {
+		t.Fatalf("error %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// After the cooldown a single probe goes through; a failed one re-opens the circuit.
+	time.Sleep(policy.BreakerCooldown)
+	host := hostOf(srv.URL)
+	if allowed, probe := client.breakers.Allow(host, policy); !allowed || !probe {
+		t.Fatalf("Allow after cooldown = %v, %v; want a probe", allowed, probe)
+	}
+	if allowed, _ := client.breakers.Allow(host, policy); allowed {
+		t.Fatal("a second request was allowed while the probe is running")
+	}
+	client.breakers.Record(host, true, policy)
+	client.breakers.EndProbe(host)
+	if _, err := client.Fetch(context.Background(), srv.URL, discard); err != ErrCircuitOpen {
+		t.Fatalf("after a failed probe: error %v, want %v", err, ErrCircuitOpen)
+	}
+
+	// A successful probe closes it.
+	time.Sleep(policy.BreakerCooldown)
+	atomic.StoreInt32(&healthy, 1)
+	if _, err := client.Fetch(context.Background(), srv.URL, discard); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if _, err := client.Fetch(context.Background(), srv.URL, discard); err != nil {
+		t.Fatalf("after a successful probe: %v", err)
+	}
+}
+
+func TestBreakerCancelledProbe(t *testing.T) {
+	var healthy int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.LoadInt32(&healthy) {
+		case 0:
+			w.WriteHeader(http.StatusBadGateway)
+		case 1:
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	policy := testPolicy()
+	policy.MaxAttempts = 1
+	client := testClient(policy)
+	for i := 0; i < policy.BreakerThreshold; i++ {
+		client.Fetch(context.Background(), srv.URL, discard)
+	}
+
+	// The probe hangs and is cancelled, so it never records an outcome.
+	time.Sleep(policy.BreakerCooldown)
+	atomic.StoreInt32(&healthy, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.Fetch(ctx, srv.URL, discard); err != context.DeadlineExceeded {
+		t.Fatalf("probe: error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The next request becomes the probe instead of finding the circuit stuck open.
+	atomic.StoreInt32(&healthy, 2)
+	if _, err := client.Fetch(context.Background(), srv.URL, discard); err != nil {
+		t.Fatalf("request after a cancelled probe: %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package zing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/Taik/zing-mp3/provider"
+)
+
+// SearchBaseURL is where search pages are requested from.
+var SearchBaseURL = "http://mp3.zing.vn/tim-kiem/"
+
+var (
+	// searchPages maps every kind to its search page below SearchBaseURL.
+	searchPages = map[provider.SearchKind]string{
+		provider.SearchTracks:      "bai-hat.html",
+		provider.SearchCollections: "playlist.html",
+		provider.SearchArtists:     "nghe-si.html",
+		provider.SearchVideos:      "video.html",
+	}
+
+	// searchPaths are the URL path prefixes of each kind's pages on Zing.
+	searchPaths = map[provider.SearchKind][]string{
+		provider.SearchTracks:      {"/bai-hat/"},
+		provider.SearchCollections: {"/album/", "/playlist/"},
+		provider.SearchArtists:     {"/nghe-si/"},
+		provider.SearchVideos:      {"/video-clip/"},
+	}
+)
+
+// Search queries Zing for results of the given kind. The results are the same
+// provider.SearchResult other providers return, with Provider set to ProviderName.
+func Search(ctx context.Context, query string, kind provider.SearchKind) ([]provider.SearchResult, error) {
+	return DefaultClient.Search(ctx, query, kind)
+}
+
+// Search queries Zing for results of the given kind. Both the HTML search pages and
+// JSON search responses are understood.
+func (c *Client) Search(ctx context.Context, query string, kind provider.SearchKind) ([]provider.SearchResult, error) {
+	page, ok := searchPages[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown search kind %q", kind)
+	}
+	searchURL := SearchBaseURL + page + "?q=" + url.QueryEscape(query)
+	Logger.Debug("Searching", "search_url", searchURL)
+
+	var results []provider.SearchResult
+	_, err := c.Fetch(ctx, searchURL, func(response *http.Response) error {
+		var err error
+		mediaType, _, _ := mime.ParseMediaType(response.Header.Get("Content-Type"))
+		if mediaType == "application/json" {
+			results, err = parseSearchJSON(response, kind)
+		} else {
+			results, err = parseSearchHTML(response, kind)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// hasKindPath reports whether the path of u belongs to a page of kind.
+func hasKindPath(u *url.URL, kind provider.SearchKind) bool {
+	for _, prefix := range searchPaths[kind] {
+		if strings.HasPrefix(u.Path, prefix) && len(u.Path) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// resultID returns the ID in a result URL: the trailing ID of song, album and video
+// pages, or the name of an artist.
+func resultID(u *url.URL, kind provider.SearchKind) string {
+	if kind == provider.SearchArtists {
+		return strings.Trim(strings.TrimPrefix(u.Path, "/nghe-si/"), "/")
+	}
+	return idFromURL(u.String())
+}
+
+// parseSearchHTML finds the results of a search page by their links, which are far more
+// stable than the markup around them.
+func parseSearchHTML(response *http.Response, kind provider.SearchKind) ([]provider.SearchResult, error) {
+	doc, err := goquery.NewDocumentFromResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []provider.SearchResult{}
+	seen := make(map[string]bool)
+	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		u, err := response.Request.URL.Parse(href)
+		if err != nil || !hasKindPath(u, kind) {
+			return
+		}
+		u.RawQuery, u.Fragment = "", ""
+		if seen[u.String()] {
+			return
+		}
+
+		title, _ := a.Attr("title")
+		if title == "" {
+			title = a.Text()
+		}
+		title = strings.TrimSpace(title)
+		if title == "" {
+			// Cover images link to the same page; wait for the titled link.
+			return
+		}
+		seen[u.String()] = true
+
+		result := provider.SearchResult{
+			Provider: ProviderName,
+			Kind:     kind,
+			ID:       resultID(u, kind),
+			Title:    title,
+			URL:      u.String(),
+		}
+		if kind != provider.SearchArtists {
+			artists := []string{}
+			a.Closest("li, div[class*=item]").Find("a[href*='/nghe-si/']").Each(func(_ int, artist *goquery.Selection) {
+				if name := strings.TrimSpace(artist.Text()); name != "" {
+					artists = append(artists, name)
+				}
+			})
+			result.Artist = strings.Join(artists, ", ")
+		}
+		results = append(results, result)
+	})
+	return results, nil
+}
+
+// searchJSONItem is a result as returned by Zing's JSON search endpoints.
+type searchJSONItem struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Link   string `json:"link"`
+}
+
+// parseSearchJSON decodes a JSON search response, either a bare list of results or
+// {"data": [...]} holding them, possibly grouped by kind as {"data": [{"song": [...]}]}.
+func parseSearchJSON(response *http.Response, kind provider.SearchKind) ([]provider.SearchResult, error) {
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	raw := json.RawMessage{}
+	if err := json.NewDecoder(response.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	if len(raw) > 0 && raw[0] == '{' {
+		if err := json.Unmarshal(raw, &body); err != nil {
+			return nil, err
+		}
+		raw = body.Data
+	}
+
+	// Groups hold lists where items hold strings, so a response decodes as one or the
+	// other; a flat list of items is tried second as its decoding error is reported.
+	items := []searchJSONItem{}
+	grouped := []map[string][]searchJSONItem{}
+	if err := json.Unmarshal(raw, &grouped); err == nil {
+		for _, group := range grouped {
+			items = append(items, group[string(kind)]...)
+		}
+	} else if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+
+	results := []provider.SearchResult{}
+	for _, item := range items {
+		title := item.Title
+		if title == "" {
+			title = item.Name
+		}
+		u, err := response.Request.URL.Parse(item.Link)
+		if err != nil || title == "" {
+			continue
+		}
+
+		id := item.ID
+		if id == "" {
+			id = resultID(u, kind)
+		}
+		results = append(results, provider.SearchResult{
+			Provider: ProviderName,
+			Kind:     kind,
+			ID:       id,
+			Title:    title,
+			Artist:   item.Artist,
+			URL:      u.String(),
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,176 @@
+package zing
+
+import (
+	"context"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/Taik/zing-mp3/provider"
+)
+
+// searchServer serves the testdata files by search page, e.g. "bai-hat.html" for
+// songs, with the content type of the file's extension.
+func searchServer(t *testing.T, pages map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := pages[filepath.Base(r.URL.Path)]
+		if !ok || r.URL.Query().Get("q") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(name))+"; charset=utf-8")
+		w.Write(data)
+	}))
+}
+
+func search(t *testing.T, srv *httptest.Server, kind provider.SearchKind) []provider.SearchResult {
+	defer func(base string) { SearchBaseURL = base }(SearchBaseURL)
+	SearchBaseURL = srv.URL + "/tim-kiem/"
+
+	results, err := testClient(testPolicy()).Search(context.Background(), "lạc trôi", kind)
+	if err != nil {
+		t.Fatalf("Search(%s): %v", kind, err)
+	}
+	return results
+}
+
+func checkResults(t *testing.T, kind provider.SearchKind, got, want []provider.SearchResult) {
+	if len(got) != len(want) {
+		t.Errorf("%s: got %d results, want %d: %+v", kind, len(got), len(want), got)
+		return
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("%s result %d:\n got %+v\nwant %+v", kind, i, got[i], want[i])
+		}
+	}
+}
+
+func TestSearchHTML(t *testing.T) {
+	srv := searchServer(t, map[string]string{
+		"bai-hat.html": "search_song.html",
+		"nghe-si.html": "search_artist.html",
+	})
+	defer srv.Close()
+
+	// Relative links resolve against the search page, absolute ones are kept; cover
+	// images, repeated links, queries and fragments do not add results.
+	checkResults(t, provider.SearchTracks, search(t, srv, provider.SearchTracks), []provider.SearchResult{
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchTracks,
+			ID:       "ZW9DBD6O",
+			Title:    "Lạc Trôi",
+			Artist:   "Sơn Tùng M-TP",
+			URL:      srv.URL + "/bai-hat/Lac-Troi-Son-Tung-M-TP/ZW9DBD6O.html",
+		},
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchTracks,
+			ID:       "ZW9DCE0A",
+			Title:    "Lạc Trôi (Triple D Remix)",
+			Artist:   "Sơn Tùng M-TP, Triple D",
+			URL:      srv.URL + "/bai-hat/Lac-Troi-Triple-D-Remix-Son-Tung-M-TP-Triple-D/ZW9DCE0A.html",
+		},
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchTracks,
+			ID:       "ZW9E0IZ8",
+			Title:    "Lạc Trôi (Acoustic Version)",
+			Artist:   "Various Artists",
+			URL:      "http://mp3.zing.vn/bai-hat/Lac-Troi-Acoustic-Version-Various-Artists/ZW9E0IZ8.html",
+		},
+	})
+
+	checkResults(t, provider.SearchArtists, search(t, srv, provider.SearchArtists), []provider.SearchResult{
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchArtists,
+			ID:       "Son-Tung-M-TP",
+			Title:    "Sơn Tùng M-TP",
+			URL:      srv.URL + "/nghe-si/Son-Tung-M-TP",
+		},
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchArtists,
+			ID:       "Son-Tung-MTP-Fan-Club",
+			Title:    "Sơn Tùng MTP Fan Club",
+			URL:      srv.URL + "/nghe-si/Son-Tung-MTP-Fan-Club/",
+		},
+	})
+}
+
+func TestSearchJSON(t *testing.T) {
+	srv := searchServer(t, map[string]string{
+		"bai-hat.html":  "search_grouped.json",
+		"playlist.html": "search_grouped.json",
+		"video.html":    "search_video.json",
+	})
+	defer srv.Close()
+
+	checkResults(t, provider.SearchTracks, search(t, srv, provider.SearchTracks), []provider.SearchResult{
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchTracks,
+			ID:       "ZW9DBD6O",
+			Title:    "Lạc Trôi",
+			Artist:   "Sơn Tùng M-TP",
+			URL:      srv.URL + "/bai-hat/Lac-Troi-Son-Tung-M-TP/ZW9DBD6O.html",
+		},
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchTracks,
+			ID:       "ZW9DCE0A",
+			Title:    "Lạc Trôi (Triple D Remix)",
+			Artist:   "Sơn Tùng M-TP, Triple D",
+			URL:      srv.URL + "/bai-hat/Lac-Troi-Triple-D-Remix-Son-Tung-M-TP-Triple-D/ZW9DCE0A.html",
+		},
+	})
+
+	checkResults(t, provider.SearchCollections, search(t, srv, provider.SearchCollections), []provider.SearchResult{
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchCollections,
+			ID:       "ZOAE6CUW",
+			Title:    "Lạc Trôi (Single)",
+			Artist:   "Sơn Tùng M-TP",
+			URL:      srv.URL + "/album/Lac-Troi-Single-Son-Tung-M-TP/ZOAE6CUW.html",
+		},
+	})
+
+	// Untitled results are dropped and missing IDs are taken from the link.
+	checkResults(t, provider.SearchVideos, search(t, srv, provider.SearchVideos), []provider.SearchResult{
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchVideos,
+			ID:       "ZW9DBDBA",
+			Title:    "Lạc Trôi",
+			Artist:   "Sơn Tùng M-TP",
+			URL:      "http://mp3.zing.vn/video-clip/Lac-Troi-Son-Tung-M-TP/ZW9DBDBA.html",
+		},
+		{
+			Provider: ProviderName,
+			Kind:     provider.SearchVideos,
+			ID:       "ZW9DBDBB",
+			Title:    "Chạy Ngay Đi",
+			Artist:   "Sơn Tùng M-TP",
+			URL:      srv.URL + "/video-clip/Chay-Ngay-Di-Son-Tung-M-TP/ZW9DBDBB.html",
+		},
+	})
+}
+
+func TestSearchUnknownKind(t *testing.T) {
+	if _, err := testClient(testPolicy()).Search(context.Background(), "lạc trôi", "podcast"); err == nil {
+		t.Error("Search with an unknown kind succeeded")
+	}
+}
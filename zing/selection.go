@@ -0,0 +1,117 @@
+package zing
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Range is an inclusive range of 1-based item numbers. An End of 0 means "until the last item".
+type Range struct {
+	Start, End int
+}
+
+// Selection picks a subset of an album's items. The zero Selection picks every item.
+type Selection struct {
+	// Items lists the item numbers to keep; empty keeps all of them.
+	Items []Range
+	// Match, when set, keeps only items whose "Artist - Title" matches.
+	Match *regexp.Regexp
+	// Exclude lists item numbers to drop after Items and Match are applied.
+	Exclude []Range
+}
+
+// ParseRanges parses a comma-separated list of item numbers and ranges such as "1-5,9,12-".
+func ParseRanges(spec string) ([]Range, error) {
+	ranges := []Range{}
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		var r Range
+		var err error
+		if i := strings.Index(field, "-"); i >= 0 {
+			r.Start, err = strconv.Atoi(strings.TrimSpace(field[:i]))
+			if err == nil && strings.TrimSpace(field[i+1:]) != "" {
+				r.End, err = strconv.Atoi(strings.TrimSpace(field[i+1:]))
+			}
+		} else {
+			r.Start, err = strconv.Atoi(field)
+			r.End = r.Start
+		}
+		if err != nil || r.Start < 1 || (r.End != 0 && r.End < r.Start) {
+			return nil, fmt.Errorf("invalid item range %q", field)
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+// ParseSelection builds a Selection from the textual forms used by the CLI and web server:
+// item ranges, a title/artist regular expression and excluded ranges. Empty strings are ignored.
+func ParseSelection(items, match, exclude string) (Selection, error) {
+	sel := Selection{}
+
+	var err error
+	sel.Items, err = ParseRanges(items)
+	if err != nil {
+		return sel, err
+	}
+	sel.Exclude, err = ParseRanges(exclude)
+	if err != nil {
+		return sel, err
+	}
+	if match != "" {
+		sel.Match, err = regexp.Compile("(?i)" + match)
+		if err != nil {
+			return sel, fmt.Errorf("invalid match pattern: %v", err)
+		}
+	}
+	return sel, nil
+}
+
+// IsAll reports whether the selection keeps every item.
+func (s Selection) IsAll() bool {
+	return len(s.Items) == 0 && s.Match == nil && len(s.Exclude) == 0
+}
+
+func inRanges(ranges []Range, n int) bool {
+	for _, r := range ranges {
+		if n >= r.Start && (r.End == 0 || n <= r.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns a copy of the album holding only the items picked by sel, in album order.
+// It fails if sel names an item number past the end of the album.
+func (a *Album) Select(sel Selection) (*Album, error) {
+	for _, r := range sel.Items {
+		if r.Start > len(a.Items) || r.End > len(a.Items) {
+			return nil, fmt.Errorf("item range %d-%d is out of range, album has %d items",
+				r.Start, r.End, len(a.Items))
+		}
+	}
+
+	// Copy every album level field, keeping only the items to be filtered below.
+	selected := *a
+	selected.Items = nil
+	for i, item := range a.Items {
+		n := i + 1
+		if len(sel.Items) > 0 && !inRanges(sel.Items, n) {
+			continue
+		}
+		if sel.Match != nil && !sel.Match.MatchString(strings.TrimSpace(item.Artist)+" - "+strings.TrimSpace(item.Title)) {
+			continue
+		}
+		if inRanges(sel.Exclude, n) {
+			continue
+		}
+		selected.Items = append(selected.Items, item)
+	}
+	return &selected, nil
+}
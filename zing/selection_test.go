@@ -0,0 +1,122 @@
+package zing
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSelectKeepsAlbumFields(t *testing.T) {
+	album := &Album{
+		ArtworkURL: "https://photo-zmp3.zadn.vn/cover/a.jpg",
+		Items: []AlbumItem{
+			{Title: "One", Artist: "A"},
+			{Title: "Two", Artist: "B"},
+			{Title: "Three", Artist: "C"},
+		},
+	}
+
+	selected, err := album.Select(Selection{Items: []Range{{Start: 2, End: 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected.ArtworkURL != album.ArtworkURL {
+		t.Errorf("ArtworkURL = %q, want %q", selected.ArtworkURL, album.ArtworkURL)
+	}
+	if len(selected.Items) != 2 || selected.Items[0].Title != "Two" {
+		t.Errorf("Items = %+v, want items 2 and 3", selected.Items)
+	}
+	if len(album.Items) != 3 {
+		t.Errorf("Select modified the album, it has %d items", len(album.Items))
+	}
+}
+
+func TestParseRanges(t *testing.T) {
+	cases := []struct {
+		spec string
+		want []Range
+	}{
+		{"", []Range{}},
+		{"3", []Range{{3, 3}}},
+		{"1-5,9,12-", []Range{{1, 5}, {9, 9}, {12, 0}}},
+		{"12-", []Range{{12, 0}}},
+		{"3-3", []Range{{3, 3}}},
+		{" 2 - 4 ,\t7 ", []Range{{2, 4}, {7, 7}}},
+		{"1,,3,", []Range{{1, 1}, {3, 3}}},
+		{" , ", []Range{}},
+	}
+	for _, c := range cases {
+		got, err := ParseRanges(c.spec)
+		if err != nil {
+			t.Errorf("ParseRanges(%q): %v", c.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseRanges(%q) = %v, want %v", c.spec, got, c.want)
+		}
+	}
+
+	for _, spec := range []string{"0", "0-3", "5-3", "-3", "-", "a", "1-b", "1-2-3", "1.5", "3,x"} {
+		if got, err := ParseRanges(spec); err == nil {
+			t.Errorf("ParseRanges(%q) = %v, want an error", spec, got)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	album := &Album{Items: []AlbumItem{
+		{Title: "Lạc Trôi", Artist: "Sơn Tùng M-TP"},
+		{Title: "Chạy Ngay Đi", Artist: "Sơn Tùng M-TP"},
+		{Title: "Em Gái Mưa", Artist: "Hương Tràm"},
+		{Title: "Người Lạ Ơi", Artist: " Karik "},
+		{Title: "Nơi Này Có Anh", Artist: "Sơn Tùng M-TP"},
+	}}
+	cases := []struct {
+		items, match, exclude string
+		want                  []string
+	}{
+		{"", "", "", []string{"Lạc Trôi", "Chạy Ngay Đi", "Em Gái Mưa", "Người Lạ Ơi", "Nơi Này Có Anh"}},
+		{"4-", "", "", []string{"Người Lạ Ơi", "Nơi Này Có Anh"}},
+		{"5,1", "", "", []string{"Lạc Trôi", "Nơi Này Có Anh"}},
+		{"", "sơn tùng", "", []string{"Lạc Trôi", "Chạy Ngay Đi", "Nơi Này Có Anh"}},
+		{"", "sơn tùng", "2", []string{"Lạc Trôi", "Nơi Này Có Anh"}},
+		{"2-", "sơn tùng", "5", []string{"Chạy Ngay Đi"}},
+		{"", "^karik - người", "", []string{"Người Lạ Ơi"}},
+		{"", "", "1-3,5", []string{"Người Lạ Ơi"}},
+		{"", "sơn tùng", "1-", nil},
+		// Excluding items past the end is not an error.
+		{"", "", "4-9", []string{"Lạc Trôi", "Chạy Ngay Đi", "Em Gái Mưa"}},
+	}
+	for _, c := range cases {
+		sel, err := ParseSelection(c.items, c.match, c.exclude)
+		if err != nil {
+			t.Errorf("ParseSelection(%q, %q, %q): %v", c.items, c.match, c.exclude, err)
+			continue
+		}
+		selected, err := album.Select(sel)
+		if err != nil {
+			t.Errorf("Select(%q, %q, %q): %v", c.items, c.match, c.exclude, err)
+			continue
+		}
+		got := []string{}
+		for _, item := range selected.Items {
+			got = append(got, item.Title)
+		}
+		if len(got) != len(c.want) || (len(got) > 0 && !reflect.DeepEqual(got, c.want)) {
+			t.Errorf("Select(%q, %q, %q) = %v, want %v", c.items, c.match, c.exclude, got, c.want)
+		}
+	}
+
+	for _, items := range []string{"6", "5-6", "6-", "2,7-9"} {
+		sel, err := ParseSelection(items, "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if selected, err := album.Select(sel); err == nil {
+			t.Errorf("Select(%q) = %d items, want an out of range error", items, len(selected.Items))
+		}
+	}
+
+	if _, err := ParseSelection("", "(", ""); err == nil {
+		t.Error("ParseSelection with an invalid pattern succeeded")
+	}
+}
@@ -0,0 +1,143 @@
+package zing
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SessionDomains are the sites a cookie header given to LoadSession is sent to.
+var SessionDomains = []string{"zing.vn", "zingmp3.vn"}
+
+// ParseCookiesFile reads cookies in the Netscape cookies.txt format exported by
+// browsers and curl: one tab-separated domain, include-subdomains flag, path, secure
+// flag, expiry, name and value per line.
+func ParseCookiesFile(path string) ([]*http.Cookie, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	cookies := []*http.Cookie{}
+	scanner := bufio.NewScanner(fd)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		httpOnly := strings.HasPrefix(line, "#HttpOnly_")
+		if httpOnly {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("%s:%d: expected 7 tab-separated fields", path, n)
+		}
+		cookie := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    fields[6],
+			HttpOnly: httpOnly,
+		}
+		// As in the file, a leading dot marks cookies sent to subdomains too.
+		cookie.Domain = strings.TrimPrefix(cookie.Domain, ".")
+		if strings.EqualFold(fields[1], "TRUE") {
+			cookie.Domain = "." + cookie.Domain
+		}
+		if expires, err := strconv.ParseInt(fields[4], 10, 64); err == nil && expires > 0 {
+			cookie.Expires = time.Unix(expires, 0)
+			if cookie.Expires.Before(time.Now()) {
+				continue
+			}
+		}
+		cookies = append(cookies, cookie)
+	}
+	return cookies, scanner.Err()
+}
+
+// ParseCookieHeader reads a Cookie header such as "zmp3_sid=abc; zpsid=def" into cookies
+// sent to every SessionDomains site and its subdomains.
+func ParseCookieHeader(header string) []*http.Cookie {
+	request := http.Request{Header: http.Header{"Cookie": {header}}}
+	cookies := []*http.Cookie{}
+	for _, domain := range SessionDomains {
+		for _, cookie := range request.Cookies() {
+			c := *cookie
+			c.Domain = "." + domain
+			c.Path = "/"
+			cookies = append(cookies, &c)
+		}
+	}
+	return cookies
+}
+
+// NewSessionJar returns a cookie jar holding cookies, each stored for its own Domain.
+// Cookies whose Domain starts with a dot are also sent to subdomains; the others
+// only to that exact host.
+func NewSessionJar(cookies []*http.Cookie) (http.CookieJar, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, cookie := range cookies {
+		host := strings.TrimPrefix(cookie.Domain, ".")
+		if host == "" {
+			continue
+		}
+		if !strings.HasPrefix(cookie.Domain, ".") {
+			hostOnly := *cookie
+			hostOnly.Domain = ""
+			cookie = &hostOnly
+		}
+		path := cookie.Path
+		if path == "" {
+			path = "/"
+		}
+		jar.SetCookies(&url.URL{Scheme: "https", Host: host, Path: path}, []*http.Cookie{cookie})
+	}
+	return jar, nil
+}
+
+// LoadSession builds a logged in session from source, which is either the path of a
+// cookies.txt file or a Cookie header value.
+func LoadSession(source string) (http.CookieJar, error) {
+	var cookies []*http.Cookie
+	if _, err := os.Stat(source); err == nil {
+		cookies, err = ParseCookiesFile(source)
+		if err != nil {
+			return nil, err
+		}
+	} else if strings.Contains(source, "=") {
+		cookies = ParseCookieHeader(source)
+	} else {
+		return nil, err
+	}
+	if len(cookies) == 0 {
+		return nil, fmt.Errorf("no cookies found in %q", source)
+	}
+	return NewSessionJar(cookies)
+}
+
+// UseSession sends the cookies in jar with every request, including those to the JSON API.
+// The client's HTTPClient is copied rather than modified, as it may be shared.
+func (c *Client) UseSession(jar http.CookieJar) {
+	httpClient := *c.httpClient()
+	httpClient.Jar = jar
+	c.HTTPClient = &httpClient
+
+	if c.API != nil {
+		apiClient := *c.API.HTTPClient
+		apiClient.Jar = jar
+		c.API.HTTPClient = &apiClient
+	}
+}
@@ -0,0 +1,78 @@
+package zing
+
+import (
+	"context"
+	"sync"
+)
+
+// flightCall is an in-progress or completed lookup.
+type flightCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+
+	// waiters counts the callers still waiting; cancel stops the lookup once none are.
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup collapses concurrent lookups of the same key into a single call.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// Do runs fn once for all concurrent callers sharing key and hands each of them the result.
+// The second return value reports whether the result was shared with another caller.
+//
+// A caller whose ctx is done returns its error right away. fn runs with a context of its
+// own, which is cancelled only when every caller has given up, so one impatient caller
+// does not fail the others.
+func (g *flightGroup) Do(ctx context.Context, key string, fn func(context.Context) (interface{}, error)) (interface{}, bool, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	c, shared := g.calls[key]
+	if !shared {
+		var callCtx context.Context
+		c = &flightCall{done: make(chan struct{})}
+		callCtx, c.cancel = context.WithCancel(context.Background())
+		g.calls[key] = c
+
+		go func() {
+			value, err := fn(callCtx)
+			c.cancel()
+
+			g.mu.Lock()
+			c.value, c.err = value, err
+			g.forgetLocked(key, c)
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.value, shared, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Later callers start a fresh lookup rather than join a cancelled one.
+			c.cancel()
+			g.forgetLocked(key, c)
+		}
+		g.mu.Unlock()
+		return nil, shared, ctx.Err()
+	}
+}
+
+// forgetLocked removes c from the group, unless a newer call has replaced it.
+func (g *flightGroup) forgetLocked(key string, c *flightCall) {
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+}
@@ -0,0 +1,83 @@
+package zing
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFlightGroupCancelsWhenAllCallersLeave(t *testing.T) {
+	g := &flightGroup{}
+	started := make(chan struct{})
+	stopped := make(chan error, 1)
+	lookup := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		stopped <- ctx.Err()
+		return nil, ctx.Err()
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, _, err := g.Do(first, "album", lookup)
+		errs <- err
+	}()
+	<-started
+	go func() {
+		_, _, err := g.Do(second, "album", func(context.Context) (interface{}, error) {
+			t.Error("a concurrent lookup of the same key ran")
+			return nil, nil
+		})
+		errs <- err
+	}()
+
+	// Let the second caller join before the first leaves.
+	time.Sleep(20 * time.Millisecond)
+	cancelFirst()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("first caller got %v, want %v", err, context.Canceled)
+	}
+	select {
+	case <-stopped:
+		t.Fatal("the lookup was cancelled while a caller still waited for it")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancelSecond()
+	if err := <-errs; err != context.Canceled {
+		t.Fatalf("second caller got %v, want %v", err, context.Canceled)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the lookup kept running after every caller left")
+	}
+}
+
+func TestFlightGroupSharesResult(t *testing.T) {
+	g := &flightGroup{}
+	release := make(chan struct{})
+	album := &Album{}
+
+	results := make(chan bool, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			got, shared, err := g.Do(context.Background(), "album", func(context.Context) (interface{}, error) {
+				<-release
+				return album, nil
+			})
+			if got != album || err != nil {
+				t.Errorf("Do = %v, %v; want the album", got, err)
+			}
+			results <- shared
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if a, b := <-results, <-results; a == b {
+		t.Errorf("shared = %v and %v, want exactly one shared result", a, b)
+	}
+}